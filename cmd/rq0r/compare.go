@@ -0,0 +1,93 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/pbaettig/request0r/internal/pkg/summary"
+	log "github.com/sirupsen/logrus"
+)
+
+func addToleranceFlags(fs *flag.FlagSet, tol *summary.Tolerances) {
+	fs.Float64Var(&tol.LatencyIncreasePercent, "max-latency-increase", 10, "Acceptable increase of response duration percentiles compared to the baseline in percent")
+	fs.Float64Var(&tol.ErrorRateIncrease, "max-error-rate-increase", 1, "Acceptable increase of the error rate compared to the baseline in percentage points")
+	fs.Float64Var(&tol.ThroughputDecreasePercent, "max-throughput-decrease", 10, "Acceptable decrease of requests per second compared to the baseline in percent")
+}
+
+func compareUsage(fs *flag.FlagSet) func() {
+	return func() {
+		fmt.Println(`rq0r compare shows the differences between two run summaries saved with -save-summary
+and fails if the current run regressed beyond the configured tolerances.
+
+USAGE:
+	rq0r compare [PARAMETERS] <baseline.json> <current.json>`)
+		fmt.Println()
+
+		fmt.Println("PARAMETERS:")
+		fs.PrintDefaults()
+	}
+}
+
+// runCompare implements the compare command and returns the exit code
+func runCompare(args []string) int {
+	var tol summary.Tolerances
+	fs := flag.NewFlagSet("compare", flag.ExitOnError)
+	addToleranceFlags(fs, &tol)
+	fs.Usage = compareUsage(fs)
+	fs.Parse(args)
+
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return 1
+	}
+
+	baseline, err := summary.Load(fs.Arg(0))
+	if err != nil {
+		log.Errorf("Unable to load baseline: %s", err)
+		return 1
+	}
+	current, err := summary.Load(fs.Arg(1))
+	if err != nil {
+		log.Errorf("Unable to load summary: %s", err)
+		return 1
+	}
+
+	return reportComparison(os.Stdout, summary.Compare(baseline, current, tol))
+}
+
+// reportComparison prints cs to w and returns 2 if any regression
+// was found, 0 otherwise
+func reportComparison(w io.Writer, cs []summary.Comparison) int {
+	regressions := 0
+	for _, c := range cs {
+		fmt.Fprintf(w, "# Comparison for test \"%s\"\n", c.ID)
+		switch {
+		case c.MissingInBaseline:
+			fmt.Fprintln(w, "Test is missing in the baseline.")
+		case c.MissingInCurrent:
+			fmt.Fprintln(w, "Test is missing in the current run.")
+		default:
+			tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+			fmt.Fprintln(tw, "Metric\tBaseline\tCurrent\tChange\t")
+			for _, d := range c.Deltas {
+				flag := ""
+				if d.Regression {
+					flag = "REGRESSION"
+				}
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", d.Metric, d.Baseline, d.Current, d.Change, flag)
+			}
+			tw.Flush()
+			regressions += c.Regressions()
+		}
+		fmt.Fprintln(w)
+	}
+
+	if regressions > 0 {
+		log.Errorf("%d regressions compared to the baseline", regressions)
+		return 2
+	}
+	return 0
+}
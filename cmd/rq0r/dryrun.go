@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/pbaettig/request0r/internal/app"
+)
+
+// dryRunSamples is the number of URLs shown per urlSpec by -dry-run
+const dryRunSamples = 3
+
+// printDryRun writes the expected load of running tests to w, the sample
+// URLs are requested by the tests when they run, see Test.SampleURLs
+func printDryRun(w io.Writer, tests []*app.Test) {
+	plan := app.EstimateTests(tests)
+	fmt.Fprintf(w, "# Dry run, no requests were sent\n\n")
+
+	for _, e := range plan.Tests {
+		t := e.Test
+		fmt.Fprintf(w, "## Test \"%s\"\n", t.ID)
+		if t.Source != "" {
+			fmt.Fprintf(w, "Defined in %s\n", t.Source)
+		}
+		fmt.Fprintf(w, "Requests:\t%s\n", formatRequests(e))
+		fmt.Fprintf(w, "Concurrency:\t%d\n", t.Concurrency)
+		if e.RequestsPerSecond > 0 {
+			fmt.Fprintf(w, "Rate:\t\t%.0f requests/second", e.RequestsPerSecond)
+			if int(e.RequestsPerSecond) != t.TargetRequestsPerSecond {
+				fmt.Fprintf(w, " (%d targeted, every worker gets an equal whole share)", t.TargetRequestsPerSecond)
+			}
+			fmt.Fprintln(w)
+		} else {
+			fmt.Fprintf(w, "Rate:\t\tunthrottled\n")
+		}
+		fmt.Fprintf(w, "Duration:\t%s\n", formatDuration(e))
+		fmt.Fprintf(w, "Starts:\t\t%s\n", formatStart(e))
+		fmt.Fprintf(w, "Hosts:\t\t%s\n", strings.Join(e.Hosts, ", "))
+
+		fmt.Fprintln(w, "Sample URLs:")
+		indent := "  "
+		for i, urls := range t.SampleURLs(dryRunSamples) {
+			if len(t.Specs) > 1 {
+				fmt.Fprintf(w, "  %s\n", t.SpecName(i))
+				indent = "    "
+			}
+			for _, u := range urls {
+				fmt.Fprintf(w, "%s%s\n", indent, u)
+			}
+		}
+		fmt.Fprintln(w)
+	}
+
+	fmt.Fprintln(w, "## All tests")
+	total, known := 0, true
+	for _, e := range plan.Tests {
+		total += e.Requests
+		known = known && e.Requests > 0
+	}
+	if known {
+		fmt.Fprintf(w, "Requests:\t%d\n", total)
+	} else {
+		fmt.Fprintf(w, "Requests:\tat least %d, plus the requests of unthrottled tests running for their duration\n", total)
+	}
+	if plan.Duration > 0 {
+		fmt.Fprintf(w, "Duration:\t%s\n", plan.Duration)
+	} else {
+		fmt.Fprintf(w, "Duration:\tunknown, depends on how fast the target responds\n")
+	}
+	fmt.Fprintf(w, "Peak rate:\t%.0f requests/second", plan.PeakRequestsPerSecond)
+	if len(plan.Unthrottled) > 0 {
+		fmt.Fprintf(w, " plus the unthrottled tests %s", strings.Join(plan.Unthrottled, ", "))
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "Hosts:\t\t%s\n", strings.Join(plan.Hosts, ", "))
+}
+
+func formatRequests(e app.Estimate) string {
+	t := e.Test
+	switch {
+	case e.Requests == 0:
+		return fmt.Sprintf("as many as possible in %s", t.Duration)
+	case t.IsUnlimited() || e.Requests < t.TotalRequests():
+		return fmt.Sprintf("%d, limited by the duration of %s", e.Requests, t.Duration)
+	case e.RequestsPerSecond == 0 && t.Duration > 0:
+		return fmt.Sprintf("%d, fewer if the duration of %s passes first", e.Requests, t.Duration)
+	case len(t.Specs) > 1 && !t.IsWeighted():
+		return fmt.Sprintf("%d (%d per urlSpec)", e.Requests, t.NumRequests)
+	}
+	return fmt.Sprintf("%d", e.Requests)
+}
+
+func formatDuration(e app.Estimate) string {
+	switch {
+	case e.RequestsPerSecond > 0:
+		return e.Duration.String()
+	case e.Duration > 0:
+		return fmt.Sprintf("at most %s, unthrottled", e.Duration)
+	}
+	return "unknown, unthrottled"
+}
+
+func formatStart(e app.Estimate) string {
+	t := e.Test
+	var after string
+	if len(t.DependsOn) > 0 {
+		after = " after " + strings.Join(t.DependsOn, ", ")
+		if t.Pause > 0 {
+			after += fmt.Sprintf(" and a pause of %s", t.Pause)
+		}
+	}
+	if !e.Scheduled {
+		return "unknown," + after
+	}
+	return fmt.Sprintf("%s%s", e.Start, after)
+}
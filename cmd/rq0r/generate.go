@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/pbaettig/request0r/internal/app"
+	log "github.com/sirupsen/logrus"
+)
+
+func generateUsage(fs *flag.FlagSet) func() {
+	return func() {
+		fmt.Println(`rq0r generate prints URLs generated from the urlSpecs of a tests file without
+sending any requests.
+
+USAGE:
+	rq0r generate [PARAMETERS] -tests <tests.yaml>`)
+		fmt.Println()
+
+		fmt.Println("PARAMETERS:")
+		fs.PrintDefaults()
+	}
+}
+
+// generatedURL is a single line of the jsonl output of the generate command
+type generatedURL struct {
+	Test string `json:"test"`
+	Spec string `json:"spec"`
+	URL  string `json:"url"`
+}
+
+// runGenerate implements the generate command and returns the exit code
+func runGenerate(args []string) int {
+	var (
+		files        filesFlag
+		n            int
+		format       string
+		outputFormat string
+		seed         int64
+		strict       bool
+		only         string
+		skip         string
+		vars         = make(varsFlag)
+	)
+	fs := flag.NewFlagSet("generate", flag.ExitOnError)
+	addTestsFlag(fs, &files)
+	fs.IntVar(&n, "n", 10, "Number of URLs to generate per urlSpec")
+	fs.StringVar(&outputFormat, "output-format", "text", "Output format, text (one URL per line) or jsonl")
+	fs.Int64Var(&seed, "seed", 0, "Seed for generating URLs (default: random)")
+	fs.BoolVar(&strict, "strict", false, "Reject unknown fields in the tests file instead of warning about them")
+	addVarsFlag(fs, vars)
+	addFormatFlag(fs, "format", &format)
+	addSelectFlags(fs, &only, &skip)
+	fs.Usage = generateUsage(fs)
+	fs.Parse(args)
+
+	if len(files) == 0 || n < 0 || (outputFormat != "text" && outputFormat != "jsonl") {
+		fs.Usage()
+		return 1
+	}
+
+	tests, err := app.LoadTestsFromFiles(files, app.LoadOptions{Strict: strict, Vars: vars, Format: format})
+	if err != nil {
+		log.Errorln("Unable to load tests from file:")
+		printLoadError(os.Stderr, err)
+		return 1
+	}
+	tests = selectTests(tests, only, skip)
+
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	for _, t := range tests {
+		t.Seed = seed
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	defer w.Flush()
+	if err := writeGeneratedURLs(w, tests, n, outputFormat); err != nil {
+		log.Errorf("Unable to write URLs: %s", err)
+		return 1
+	}
+	return 0
+}
+
+// writeGeneratedURLs writes n URLs for every spec of tests to w, they are
+// requested by the tests when they run with their Seed, see
+// Test.SampleURLs
+func writeGeneratedURLs(w io.Writer, tests []*app.Test, n int, format string) error {
+	enc := json.NewEncoder(w)
+	for _, t := range tests {
+		for i, urls := range t.SampleURLs(n) {
+			if len(urls) < n {
+				log.WithFields(log.Fields{
+					"test": t.ID,
+					"spec": t.SpecName(i),
+				}).Warnf("Only %d URLs could be generated, the test requests fewer or a feeder is exhausted", len(urls))
+			}
+			for _, u := range urls {
+				var err error
+				if format == "jsonl" {
+					err = enc.Encode(generatedURL{Test: t.ID, Spec: t.SpecName(i), URL: u})
+				} else {
+					_, err = fmt.Fprintln(w, u)
+				}
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -3,28 +3,115 @@ package main
 import (
 	"flag"
 	"fmt"
-	"math/rand"
+	"net/http"
 	"os"
+	"strings"
 	"sync"
 	"time"
 
-	"github.com/pbaettig/request0r/internal/pkg/statutils"
+	"github.com/pbaettig/request0r/internal/pkg/htmlreport"
+	"github.com/pbaettig/request0r/internal/pkg/junit"
+	"github.com/pbaettig/request0r/internal/pkg/metrics"
+	"github.com/pbaettig/request0r/internal/pkg/sinks"
+	"github.com/pbaettig/request0r/internal/pkg/summary"
 
 	"github.com/pbaettig/request0r/internal/app"
-	"github.com/pbaettig/request0r/internal/pkg/resultutils"
 	log "github.com/sirupsen/logrus"
 )
 
 var (
-	testsFilename string
-	debug         bool
+	testsFiles     filesFlag
+	htmlReportPath string
+	junitPath      string
+	metricsAddr    string
+	statsdAddr     string
+	influxURL      string
+	influxToken    string
+	flushInterval  time.Duration
+	summaryPath    string
+	baselinePath   string
+	tolerances     summary.Tolerances
+	seed           int64
+	strict         bool
+	testsFormat    string
+	only           string
+	skip           string
+	vars           = make(varsFlag)
+	debug          bool
+	dryRun         bool
 )
 
 func init() {
-	rand.Seed(time.Now().UnixNano())
+	addTestsFlag(flag.CommandLine, &testsFiles)
+	addRunFlags(flag.CommandLine)
+	flag.BoolVar(&strict, "strict", false, "Reject unknown fields in the tests file instead of warning about them")
+	addVarsFlag(flag.CommandLine, vars)
+	addFormatFlag(flag.CommandLine, "format", &testsFormat)
+	addSelectFlags(flag.CommandLine, &only, &skip)
+}
+
+// filesFlag collects the values of a repeatable flag
+type filesFlag []string
+
+func (f *filesFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *filesFlag) Set(s string) error {
+	*f = append(*f, s)
+	return nil
+}
+
+// addTestsFlag adds the flag selecting the tests files to fs
+func addTestsFlag(fs *flag.FlagSet, files *filesFlag) {
+	fs.Var(files, "tests", "Path to a file containing test definitions, a directory or a glob pattern like 'tests/*.yaml', - reads from stdin. Can be repeated")
+}
+
+// addFormatFlag adds the flag name selecting the format of the tests file
+// to fs
+func addFormatFlag(fs *flag.FlagSet, name string, format *string) {
+	fs.StringVar(format, name, "", fmt.Sprintf("Format of stdin and tests files without a known extension, one of %s (default: determined by the file extension, yaml otherwise)", strings.Join(app.Formats(), ", ")))
+}
+
+// addSelectFlags adds the flags selecting the tests to run to fs, see
+// selectTests
+func addSelectFlags(fs *flag.FlagSet, only, skip *string) {
+	fs.StringVar(only, "only", "", "Comma-separated test IDs (with * wildcards) or tags of the only tests to run")
+	fs.StringVar(skip, "skip", "", "Comma-separated test IDs (with * wildcards) or tags of tests not to run")
+}
+
+// selectTests returns the tests selected by the -only and -skip flags
+func selectTests(tests []*app.Test, only, skip string) []*app.Test {
+	return app.SelectTests(tests, splitList(only), splitList(skip))
+}
+
+// splitList returns the non-empty items of the comma-separated list s
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
 
-	flag.StringVar(&testsFilename, "tests", "", "Path to file containing the test definitions")
-	flag.BoolVar(&debug, "debug", false, "Enable verbose debug logging")
+// addRunFlags adds the flags controlling how tests are run and where their
+// results are reported to fs
+func addRunFlags(fs *flag.FlagSet) {
+	fs.StringVar(&htmlReportPath, "html", "", "Write a self-contained HTML report to this file")
+	fs.StringVar(&junitPath, "junit", "", "Write a JUnit XML report to this file")
+	fs.StringVar(&metricsAddr, "metrics-addr", "", "Expose Prometheus metrics on this address (e.g. :9100) while tests are running")
+	fs.StringVar(&statsdAddr, "statsd-addr", "", "Send results to this StatsD server (host:port) via UDP")
+	fs.StringVar(&influxURL, "influx-url", "", "Send results to this InfluxDB write endpoint, e.g. http://localhost:8086/write?db=rq0r")
+	fs.StringVar(&influxToken, "influx-token", "", "Token used to authenticate against InfluxDB")
+	fs.DurationVar(&flushInterval, "sink-flush-interval", time.Second, "Interval in which results are sent to StatsD and InfluxDB")
+	fs.StringVar(&summaryPath, "save-summary", "", "Save a summary of the run as JSON to this file, see compare")
+	fs.StringVar(&baselinePath, "baseline", "", "Compare the run against a summary previously saved with -save-summary")
+	addToleranceFlags(fs, &tolerances)
+	fs.Int64Var(&seed, "seed", 0, "Seed for generating URLs, the same seed and tests generate the same URLs per worker (default: random)")
+	fs.BoolVar(&debug, "debug", false, "Enable verbose debug logging")
+	fs.BoolVar(&dryRun, "dry-run", false, "Print the expected number of requests, duration, rate, target hosts and sample URLs of the tests instead of running them")
 }
 
 func usage() {
@@ -33,71 +120,224 @@ easy way to generate load on a target service and provide some statistics about
 it received.`)
 	fmt.Println()
 
+	fmt.Println(`USAGE:
+	rq0r [PARAMETERS]
+	rq0r run [PARAMETERS] <url>
+	rq0r compare [PARAMETERS] <baseline.json> <current.json>
+	rq0r generate [PARAMETERS] -tests <tests.yaml>
+	rq0r validate [-strict] [-var key=value] [-format yaml|json|toml] <tests.yaml|-> [<tests.yaml> ...]
+	rq0r schema`)
+	fmt.Println()
+
 	fmt.Println("PARAMETERS:")
 	flag.PrintDefaults()
 }
 
 func main() {
-	flag.Parse()
-
-	if debug {
-		log.SetLevel(log.DebugLevel)
-	} else {
-		log.SetLevel(log.InfoLevel)
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "run":
+			os.Exit(runURL(os.Args[2:]))
+		case "compare":
+			os.Exit(runCompare(os.Args[2:]))
+		case "generate":
+			os.Exit(runGenerate(os.Args[2:]))
+		case "validate":
+			os.Exit(runValidate(os.Args[2:]))
+		case "schema":
+			os.Exit(runSchema(os.Args[2:]))
+		}
 	}
 
-	if testsFilename == "" {
+	flag.Parse()
+	setLogLevel()
+
+	if len(testsFiles) == 0 {
 		usage()
 		os.Exit(1)
 	}
 
-	tests, err := app.LoadTestsFromFile(testsFilename)
+	tests, err := app.LoadTestsFromFiles(testsFiles, app.LoadOptions{Strict: strict, Vars: vars, Format: testsFormat})
 	if err != nil {
-		log.Fatalf("Unable to load tests from file: %s", err)
+		log.Errorln("Unable to load tests from file:")
+		printLoadError(os.Stderr, err)
+		os.Exit(1)
 	}
 
 	if len(tests) == 0 {
 		log.Fatalln("No tests defined.")
 	}
+	if tests = selectTests(tests, only, skip); len(tests) == 0 {
+		log.Fatalln("No tests match -only and -skip.")
+	}
+	os.Exit(runTests(tests))
+}
+
+func setLogLevel() {
+	if debug {
+		log.SetLevel(log.DebugLevel)
+	} else {
+		log.SetLevel(log.InfoLevel)
+	}
+}
+
+// runTests runs tests, reports their results according to the flags
+// added by addRunFlags and returns the exit code
+func runTests(tests []*app.Test) int {
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	log.Infof("Using seed %d, pass -seed %d to generate the same URLs again", seed, seed)
+	for _, test := range tests {
+		test.Seed = seed
+	}
+	if dryRun {
+		printDryRun(os.Stdout, tests)
+		return 0
+	}
+
+	var collector *metrics.Collector
+	var outputs []sinks.Sink
+	if metricsAddr != "" {
+		collector = metrics.NewCollector()
+		outputs = append(outputs, collector)
+		go serveMetrics(metricsAddr, collector)
+	}
+	if statsdAddr != "" {
+		s, err := sinks.NewStatsD(statsdAddr, "rq0r.", flushInterval)
+		if err != nil {
+			log.Fatalf("Unable to connect to StatsD: %s", err)
+		}
+		outputs = append(outputs, s)
+	}
+	if influxURL != "" {
+		outputs = append(outputs, sinks.NewInfluxDB(influxURL, influxToken, "rq0r_request", flushInterval))
+	}
 
 	testWait := new(sync.WaitGroup)
+	resultsLock := new(sync.Mutex)
 	testResults := make(map[string][]app.WorkerResult)
 	testStats := make(map[string][]app.WorkerStats)
+	setupErrors := make(map[string]error)
+
+	// done is closed once the respective test has finished, tests wait
+	// for the tests they depend on before they start
+	done := make(map[*app.Test]chan struct{})
+	byID := make(map[string][]*app.Test)
+	for _, test := range tests {
+		done[test] = make(chan struct{})
+		byID[test.ID] = append(byID[test.ID], test)
+	}
+
+	// The setup of a tests file runs once before all its tests, if it
+	// fails none of them are started
+	var suites []*app.Suite
+	suiteErrors := make(map[*app.Suite]error)
+	for _, test := range tests {
+		s := test.Suite
+		if s == nil {
+			continue
+		}
+		if _, ok := suiteErrors[s]; ok {
+			continue
+		}
+		suiteErrors[s] = s.RunSetup()
+		if err := suiteErrors[s]; err != nil {
+			log.Errorf("Setup failed: %s", err)
+		}
+		if s.NeedsTeardown() {
+			suites = append(suites, s)
+		}
+	}
 
 	testStart := time.Now()
 	for _, test := range tests {
-		test.Start()
 		testWait.Add(1)
 
-		log.WithFields(log.Fields{
-			"test": test.ID,
-		}).Info("Started")
-
 		go func(t *app.Test, wg *sync.WaitGroup) {
-			t.Wait()
-			log.WithFields(log.Fields{
-				"test": t.ID,
-			}).Info("Finished")
-			wg.Done()
+			defer wg.Done()
+			defer close(done[t])
 
-			// Collect worker stats
-			for s := range t.Stats {
-				testStats[t.ID] = append(testStats[t.ID], s)
+			if len(t.DependsOn) > 0 {
+				log.WithFields(log.Fields{
+					"test": t.ID,
+				}).Infof("Waiting for %s", strings.Join(t.DependsOn, ", "))
+				for _, id := range t.DependsOn {
+					for _, dep := range byID[id] {
+						<-done[dep]
+					}
+				}
+				time.Sleep(t.Pause)
+			}
+
+			err := suiteErrors[t.Suite]
+			if err == nil {
+				err = t.RunSetup()
+			}
+			// Tear down whatever a partially failed setup created
+			if t.NeedsTeardown() {
+				defer func() {
+					if err := t.RunTeardown(); err != nil {
+						log.WithFields(log.Fields{
+							"test": t.ID,
+						}).Warnf("Teardown failed: %s", err)
+					}
+				}()
+			}
+			if err != nil {
+				log.WithFields(log.Fields{
+					"test": t.ID,
+				}).Errorf("Setup failed: %s", err)
+				resultsLock.Lock()
+				setupErrors[t.ID] = err
+				resultsLock.Unlock()
+				return
+			}
+
+			// Register right before starting, so the rate isn't measured
+			// from a start time that includes waiting and setup
+			if collector != nil {
+				collector.Register(t)
 			}
+			t.Start()
+
+			log.WithFields(log.Fields{
+				"test": t.ID,
+			}).Info("Started")
 
 			i := 0
 			log.WithFields(log.Fields{
 				"test": t.ID,
 			}).Debugf("Reading results from %p", t.Out)
 
-			// Collect test results
+			// Collect test results while the test is running, t.Out
+			// is closed once all workers have finished
+			var results []app.WorkerResult
 			for r := range t.Out {
 				i++
-				testResults[t.ID] = append(testResults[t.ID], r)
+				results = append(results, r)
+				for _, o := range outputs {
+					o.Observe(t, r)
+				}
 				log.WithFields(log.Fields{
 					"test": t.ID,
-				}).Debugf("Got result for %s (%d/%d)", r.URL, i, t.NumRequests)
+				}).Debugf("Got result for %s (%d/%d)", r.URL, i, t.TotalRequests())
 			}
+			log.WithFields(log.Fields{
+				"test": t.ID,
+			}).Info("Finished")
+
+			// Collect worker stats
+			var stats []app.WorkerStats
+			for s := range t.Stats {
+				stats = append(stats, s)
+			}
+
+			resultsLock.Lock()
+			testResults[t.ID] = results
+			testStats[t.ID] = stats
+			resultsLock.Unlock()
+
 			log.WithFields(log.Fields{
 				"test": t.ID,
 			}).Debug("All results processed")
@@ -109,63 +349,110 @@ func main() {
 	testsDuration := time.Now().Sub(testStart)
 	log.Infof("Ran %d Tests in %s", len(tests), testsDuration)
 
+	for _, s := range suites {
+		if err := s.RunTeardown(); err != nil {
+			log.Warnf("Teardown failed: %s", err)
+		}
+	}
+
+	for _, o := range outputs {
+		if err := o.Close(); err != nil {
+			log.Warnf("Unable to flush results: %s", err)
+		}
+	}
+
 	// sleep some more to ensure any remaining log output is not
 	// mixed in with the results below
 	time.Sleep(200 * time.Millisecond)
-	fmt.Printf("\n-----------------------\n\n")
+
+	var runs []app.TestRun
 	for _, test := range tests {
-		fmt.Printf("# Results for test \"%s\"\n", test.ID)
-		fmt.Println("## Worker Stats")
-		fmt.Printf("Worker Runtime\n")
-		for _, s := range testStats[test.ID] {
-			fmt.Printf("%s:\t%.1f requests/second\t%d requests processed\t(in %s)\n", s.ID, s.RequestsPerSecond, s.RequestsProcessed, s.Runtime)
+		runs = append(runs, app.TestRun{
+			Test:       test,
+			Results:    testResults[test.ID],
+			Stats:      testStats[test.ID],
+			SetupError: setupErrors[test.ID],
+		})
+	}
+
+	fmt.Printf("\n-----------------------\n\n")
+	failedChecks := 0
+	for _, run := range runs {
+		failedChecks += printReport(run)
+	}
+
+	if htmlReportPath != "" {
+		if err := writeHTMLReport(htmlReportPath, runs, testsDuration); err != nil {
+			log.Fatalf("Unable to write HTML report: %s", err)
 		}
-		trps := statutils.SumRequestsPerSecond(testStats[test.ID])
-		fmt.Printf("\t\t%.1f total\t\t%d total\n", trps, test.NumRequests)
-		fmt.Println()
-		fmt.Println("## Respone duration Percentiles")
-		pd := resultutils.GetDurationPercentiles(testResults[test.ID])
-		fmt.Printf("%d%%\t%s\n", 99, pd[0.99])
-		fmt.Printf("%d%%\t%s\n", 95, pd[0.95])
-		fmt.Printf("%d%%\t%s\n", 90, pd[0.9])
-		fmt.Printf("%d%%\t%s\n", 50, pd[0.5])
-		fmt.Printf("%d%%\t%s\n", 10, pd[0.1])
-		fmt.Printf("%d%%\t%s\n", 1, pd[0.01])
-		fmt.Println()
-		fmt.Println("## Errors")
-		errors := resultutils.GetErrors(testResults[test.ID])
-		errorPercent := float64(len(errors)) * 100.0 / float64(len(testResults[test.ID]))
-		if errorPercent > 0 {
-			fmt.Printf("%.1f%% (%d/%d) of requests failed.\n", errorPercent, len(errors), len(testResults[test.ID]))
-
-			if len(errors) <= 10 {
-				fmt.Println("Error messages:")
-				for _, e := range errors {
-					fmt.Printf("- %s\n", e)
-				}
-			} else {
-				fmt.Println("More than 10 errors occured. First 10 error messages:")
-				for _, e := range errors[:10] {
-					fmt.Printf("- %s\n", e)
-				}
-			}
+		log.Infof("HTML report written to %s", htmlReportPath)
+	}
 
-			fmt.Println()
+	if junitPath != "" {
+		if err := writeJUnitReport(junitPath, runs, testStart, testsDuration); err != nil {
+			log.Fatalf("Unable to write JUnit report: %s", err)
+		}
+		log.Infof("JUnit report written to %s", junitPath)
+	}
 
-		} else {
-			fmt.Println("No errors occured.")
+	exitCode := 0
+	if summaryPath != "" || baselinePath != "" {
+		current := summary.New(runs, testStart)
+		if summaryPath != "" {
+			if err := summary.Save(summaryPath, current); err != nil {
+				log.Fatalf("Unable to save summary: %s", err)
+			}
+			log.Infof("Summary saved to %s", summaryPath)
 		}
-		fmt.Println()
-		fmt.Println("## Response Status codes")
-		sum := 0
-		for s, c := range resultutils.CountResponseStatusCodes(testResults[test.ID]) {
-			p := float64(c) / float64(len(testResults[test.ID]))
-			fmt.Printf("HTTP%d\t%.1f%%\t(%d)\n", s, p*100, c)
-			sum += c
+		if baselinePath != "" {
+			baseline, err := summary.Load(baselinePath)
+			if err != nil {
+				log.Fatalf("Unable to load baseline: %s", err)
+			}
+			fmt.Printf("-----------------------\n\n")
+			exitCode = reportComparison(os.Stdout, summary.Compare(baseline, current, tolerances))
 		}
-		fmt.Printf("\t\t(%d total)", sum)
-		fmt.Println()
-		fmt.Println()
 	}
 
+	if failedChecks > 0 {
+		log.Errorf("%d checks failed", failedChecks)
+		exitCode = 2
+	}
+	return exitCode
+}
+
+func serveMetrics(addr string, c *metrics.Collector) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", c)
+
+	log.Infof("Serving metrics on %s/metrics", addr)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		log.Fatalf("Unable to serve metrics: %s", err)
+	}
+}
+
+func writeHTMLReport(path string, runs []app.TestRun, duration time.Duration) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := htmlreport.Write(f, runs, duration); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func writeJUnitReport(path string, runs []app.TestRun, start time.Time, duration time.Duration) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := junit.Write(f, runs, start, duration); err != nil {
+		return err
+	}
+	return f.Close()
 }
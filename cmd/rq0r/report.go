@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/pbaettig/request0r/internal/app"
+	"github.com/pbaettig/request0r/internal/pkg/checkutils"
+	"github.com/pbaettig/request0r/internal/pkg/resultutils"
+	"github.com/pbaettig/request0r/internal/pkg/statutils"
+)
+
+// printReport prints the text report for run to stdout and returns the
+// number of failed checks
+func printReport(run app.TestRun) int {
+	test := run.Test
+	fmt.Printf("# Results for test \"%s\"\n", test.ID)
+	if test.Source != "" {
+		fmt.Printf("Defined in %s\n\n", test.Source)
+	}
+	fmt.Println("## Worker Stats")
+	fmt.Printf("Worker Runtime\n")
+	for _, s := range run.Stats {
+		fmt.Printf("%s:\t%.1f requests/second\t%d requests processed\t(in %s)\n", s.ID, s.RequestsPerSecond, s.RequestsProcessed, s.Runtime)
+	}
+	trps := statutils.SumRequestsPerSecond(run.Stats)
+	fmt.Printf("\t\t%.1f total\t\t%d total\n", trps, len(run.Results))
+	fmt.Println()
+	printResults(run.Results, "##")
+
+	if len(test.Specs) > 1 {
+		fmt.Println("## Traffic mix")
+		specCounts := resultutils.CountSpecs(run.Results)
+		for i, spec := range test.Specs {
+			p := 0.0
+			if len(run.Results) > 0 {
+				p = float64(specCounts[i]) / float64(len(run.Results))
+			}
+			fmt.Printf("%s\t%.1f%%\t(%d)\t%.1f%% expected\n", spec.Name, p*100, specCounts[i], test.SpecShare(i)*100)
+		}
+		fmt.Println()
+
+		for i, spec := range test.Specs {
+			fmt.Printf("## Results for URLSpec \"%s\"\n", spec.Name)
+			printResults(resultutils.FilterSpec(run.Results, i), "###")
+		}
+	}
+
+	failed := 0
+	if checks := checkutils.Evaluate(run); len(checks) > 0 {
+		fmt.Println("## Checks")
+		for _, c := range checks {
+			fmt.Printf("- %s\n", c)
+		}
+		failed = len(checkutils.Failed(checks))
+		fmt.Println()
+	}
+	return failed
+}
+
+// printResults prints the response duration percentiles, errors and
+// status codes of rs using heading as prefix for the section titles
+func printResults(rs []app.WorkerResult, heading string) {
+	if len(rs) == 0 {
+		fmt.Println("No requests were made.")
+		fmt.Println()
+		return
+	}
+
+	fmt.Printf("%s Respone duration Percentiles\n", heading)
+	pd := resultutils.GetDurationPercentiles(rs)
+	fmt.Printf("%d%%\t%s\n", 99, pd[0.99])
+	fmt.Printf("%d%%\t%s\n", 95, pd[0.95])
+	fmt.Printf("%d%%\t%s\n", 90, pd[0.9])
+	fmt.Printf("%d%%\t%s\n", 50, pd[0.5])
+	fmt.Printf("%d%%\t%s\n", 10, pd[0.1])
+	fmt.Printf("%d%%\t%s\n", 1, pd[0.01])
+	fmt.Println()
+	fmt.Printf("%s Errors\n", heading)
+	errors := resultutils.GetErrors(rs)
+	errorPercent := float64(len(errors)) * 100.0 / float64(len(rs))
+	if errorPercent > 0 {
+		fmt.Printf("%.1f%% (%d/%d) of requests failed.\n", errorPercent, len(errors), len(rs))
+
+		if len(errors) <= 10 {
+			fmt.Println("Error messages:")
+			for _, e := range errors {
+				fmt.Printf("- %s\n", e)
+			}
+		} else {
+			fmt.Println("More than 10 errors occured. First 10 error messages:")
+			for _, e := range errors[:10] {
+				fmt.Printf("- %s\n", e)
+			}
+		}
+
+		fmt.Println()
+
+	} else {
+		fmt.Println("No errors occured.")
+	}
+	fmt.Println()
+	fmt.Printf("%s Response Status codes\n", heading)
+	sum := 0
+	for s, c := range resultutils.CountResponseStatusCodes(rs) {
+		p := float64(c) / float64(len(rs))
+		fmt.Printf("HTTP%d\t%.1f%%\t(%d)\n", s, p*100, c)
+		sum += c
+	}
+	fmt.Printf("\t\t(%d total)", sum)
+	fmt.Println()
+	fmt.Println()
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/pbaettig/request0r/internal/app"
+	"github.com/pbaettig/request0r/pkg/randurl"
+	log "github.com/sirupsen/logrus"
+	yaml "gopkg.in/yaml.v3"
+)
+
+func runUsage(fs *flag.FlagSet) func() {
+	return func() {
+		fmt.Println(`rq0r run sends requests to a single URL without a tests file and reports the
+results like a test.
+
+USAGE:
+	rq0r run [PARAMETERS] <url>`)
+		fmt.Println()
+
+		fmt.Println("PARAMETERS:")
+		fs.PrintDefaults()
+	}
+}
+
+// headerFlag collects the values of a repeatable -H "Name: value" flag
+type headerFlag http.Header
+
+func (h headerFlag) String() string {
+	var lines []string
+	for name, values := range h {
+		for _, v := range values {
+			lines = append(lines, name+": "+v)
+		}
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, ", ")
+}
+
+func (h headerFlag) Set(s string) error {
+	i := strings.IndexByte(s, ':')
+	if i <= 0 {
+		return fmt.Errorf(`expected "Name: value", got %q`, s)
+	}
+	http.Header(h).Add(strings.TrimSpace(s[:i]), strings.TrimSpace(s[i+1:]))
+	return nil
+}
+
+// errUsage is returned by newRunTest if the arguments are invalid
+var errUsage = errors.New("invalid arguments")
+
+// runURL implements the run command and returns the exit code
+func runURL(args []string) int {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	t, dumpYAML, err := newRunTest(fs, args)
+	if err == errUsage {
+		fs.Usage()
+		return 1
+	}
+	if err != nil {
+		log.Error(err)
+		return 1
+	}
+
+	if dumpYAML {
+		if err := writeTestsFile(os.Stdout, t); err != nil {
+			log.Errorf("Unable to write tests file: %s", err)
+			return 1
+		}
+		return 0
+	}
+	return runTests([]*app.Test{t})
+}
+
+// newRunTest adds the flags of the run command to fs, parses args and
+// returns the test they describe and whether -dump-yaml was given
+func newRunTest(fs *flag.FlagSet, args []string) (*app.Test, bool, error) {
+	t := &app.Test{Header: make(http.Header)}
+	var (
+		body     string
+		dumpYAML bool
+	)
+	fs.StringVar(&t.ID, "id", "run", "ID of the test used in reports")
+	fs.IntVar(&t.NumRequests, "n", 0, "Number of requests (default 100, unlimited if -duration is set)")
+	fs.DurationVar(&t.Duration, "duration", 0, "Make requests for this long, e.g. 30s")
+	fs.IntVar(&t.Concurrency, "c", 10, "Number of workers executing requests in parallel")
+	fs.IntVar(&t.TargetRequestsPerSecond, "rate", 0, "Target rate of requests per second (default: unthrottled)")
+	fs.StringVar(&t.Method, "method", http.MethodGet, "HTTP method of the requests")
+	fs.Var(headerFlag(t.Header), "H", `Header sent with every request, can be repeated ("Name: value")`)
+	fs.StringVar(&body, "body", "", "Body sent with every request, @file reads it from file")
+	fs.BoolVar(&dumpYAML, "dump-yaml", false, "Print the equivalent tests file instead of running the test")
+	addRunFlags(fs)
+	fs.Usage = runUsage(fs)
+	if err := fs.Parse(args); err != nil {
+		return nil, false, errUsage
+	}
+	setLogLevel()
+
+	if fs.NArg() != 1 || t.NumRequests < 0 || t.Duration < 0 || t.Concurrency <= 0 || t.TargetRequestsPerSecond < 0 {
+		return nil, false, errUsage
+	}
+	if t.NumRequests == 0 && t.Duration == 0 {
+		t.NumRequests = 100
+	}
+
+	spec, err := newURLSpec(fs.Arg(0))
+	if err != nil {
+		return nil, false, fmt.Errorf("invalid URL %s: %s", fs.Arg(0), err)
+	}
+	t.Specs = []randurl.URLSpec{spec}
+
+	t.Body = body
+	if strings.HasPrefix(body, "@") {
+		data, err := ioutil.ReadFile(body[1:])
+		if err != nil {
+			return nil, false, fmt.Errorf("unable to read body: %s", err)
+		}
+		t.Body = string(data)
+	}
+	return t, dumpYAML, nil
+}
+
+// newURLSpec returns an URLSpec that always generates rawURL
+func newURLSpec(rawURL string) (randurl.URLSpec, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return randurl.URLSpec{}, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return randurl.URLSpec{}, fmt.Errorf("scheme must be http or https")
+	}
+	if u.Host == "" {
+		return randurl.URLSpec{}, fmt.Errorf("host is missing")
+	}
+
+	spec := randurl.URLSpec{Scheme: u.Scheme, Host: u.Host}
+	var parts []string
+	for _, p := range strings.Split(u.EscapedPath(), "/") {
+		if p != "" {
+			parts = append(parts, p)
+		}
+	}
+	if u.RawQuery != "" {
+		if len(parts) == 0 {
+			parts = append(parts, "")
+		}
+		parts[len(parts)-1] += "?" + u.RawQuery
+	}
+	for _, p := range parts {
+		spec.Components = append(spec.Components, randurl.StringComponent(p))
+	}
+	spec.Name = spec.String()
+	return spec, nil
+}
+
+// testsFile, testEntry, urlSpecEntry and componentEntry describe a tests
+// file written by run -dump-yaml
+type testsFile struct {
+	Tests []testEntry `yaml:"tests"`
+}
+
+type testEntry struct {
+	ID                      string            `yaml:"id"`
+	NumRequests             int               `yaml:"numRequests,omitempty"`
+	Duration                string            `yaml:"duration,omitempty"`
+	Concurrency             int               `yaml:"concurrency"`
+	TargetRequestsPerSecond int               `yaml:"targetRequestsPerSecond,omitempty"`
+	Method                  string            `yaml:"method,omitempty"`
+	Headers                 map[string]string `yaml:"headers,omitempty"`
+	Body                    string            `yaml:"body,omitempty"`
+	URLSpecs                []urlSpecEntry    `yaml:"urlSpecs"`
+}
+
+type urlSpecEntry struct {
+	Scheme        string           `yaml:"scheme"`
+	Host          string           `yaml:"host"`
+	URIComponents []componentEntry `yaml:"uriComponents,omitempty"`
+}
+
+type componentEntry struct {
+	Type    string    `yaml:"type"`
+	Value   string    `yaml:"value,omitempty"`
+	Values  []string  `yaml:"values,omitempty"`
+	Weights []float64 `yaml:"weights,omitempty"`
+	Pattern string    `yaml:"pattern,omitempty"`
+}
+
+// writeTestsFile writes the tests file describing t to w
+func writeTestsFile(w io.Writer, t *app.Test) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(newTestsFile(t)); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// newTestsFile returns the tests file describing t, which may only have
+// string, choice and regex components
+func newTestsFile(t *app.Test) testsFile {
+	e := testEntry{
+		ID:                      t.ID,
+		NumRequests:             t.NumRequests,
+		Concurrency:             t.Concurrency,
+		TargetRequestsPerSecond: t.TargetRequestsPerSecond,
+		Body:                    t.Body,
+	}
+	if t.Duration > 0 {
+		e.Duration = t.Duration.String()
+	}
+	if t.Method != http.MethodGet {
+		e.Method = t.Method
+	}
+	for name, values := range t.Header {
+		if e.Headers == nil {
+			e.Headers = make(map[string]string)
+		}
+		e.Headers[name] = strings.Join(values, ", ")
+	}
+	for _, s := range t.Specs {
+		se := urlSpecEntry{Scheme: s.Scheme, Host: s.Host}
+		for _, c := range s.Components {
+			se.URIComponents = append(se.URIComponents, newComponentEntry(c))
+		}
+		e.URLSpecs = append(e.URLSpecs, se)
+	}
+	return testsFile{Tests: []testEntry{e}}
+}
+
+func newComponentEntry(c randurl.PathComponent) componentEntry {
+	switch c := c.(type) {
+	case randurl.ChoiceComponent:
+		return componentEntry{Type: "choice", Values: c.Values, Weights: c.Weights}
+	case randurl.RegexComponent:
+		return componentEntry{Type: "regex", Pattern: c.Pattern}
+	}
+	return componentEntry{Type: "string", Value: c.String()}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pbaettig/request0r/internal/app"
+	"github.com/pbaettig/request0r/pkg/randurl"
+)
+
+func TestNewRunTest(t *testing.T) {
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	test, dumpYAML, err := newRunTest(fs, []string{
+		"-id", "search", "-n", "50", "-c", "5", "-rate", "20", "-duration", "1m",
+		"-method", "POST", "-H", "X-Token: abc", "-body", `{"q": 1}`, "-dump-yaml",
+		"https://shop.local/search/a%20b?q=[a-z]|x",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !dumpYAML {
+		t.Error("Expected -dump-yaml to be set")
+	}
+
+	correct := &app.Test{
+		ID:                      "search",
+		NumRequests:             50,
+		Concurrency:             5,
+		TargetRequestsPerSecond: 20,
+		Duration:                time.Minute,
+		Method:                  http.MethodPost,
+		Header:                  http.Header{"X-Token": []string{"abc"}},
+		Body:                    `{"q": 1}`,
+		Specs: []randurl.URLSpec{{
+			Name:       "https://shop.local/search/a%20b?q=[a-z]|x",
+			Scheme:     "https",
+			Host:       "shop.local",
+			Components: []randurl.PathComponent{randurl.StringComponent("search"), randurl.StringComponent("a%20b?q=[a-z]|x")},
+		}},
+	}
+	if !reflect.DeepEqual(test, correct) {
+		t.Errorf("Wrong test, wanted %+v, got %+v", correct, test)
+	}
+
+	for _, args := range [][]string{
+		{},
+		{"-c", "0", "http://shop.local"},
+		{"http://shop.local", "http://other.local"},
+	} {
+		if _, _, err := newRunTest(flag.NewFlagSet("run", flag.ContinueOnError), args); err != errUsage {
+			t.Errorf("Expected a usage error for %v, got %v", args, err)
+		}
+	}
+	if _, _, err := newRunTest(flag.NewFlagSet("run", flag.ContinueOnError), []string{"ftp://shop.local"}); err == nil || err == errUsage {
+		t.Errorf("Expected an invalid URL error, got %v", err)
+	}
+}
+
+func TestWriteTestsFile(t *testing.T) {
+	test, _, err := newRunTest(flag.NewFlagSet("run", flag.ContinueOnError), []string{
+		"-id", "search", "-n", "50", "-c", "5", "-method", "PUT", "-H", "X-Token: abc", "-body", "name: x",
+		"https://shop.local/search/a%20b?q=[a-z]|x",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	regex, err := randurl.NewRegexComponent(`[A-Z]{2}-\d{4}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.Specs = append(test.Specs, randurl.URLSpec{
+		Scheme: "http",
+		Host:   "shop.local:8080",
+		Components: []randurl.PathComponent{
+			randurl.StringComponent("item"),
+			randurl.ChoiceComponent{Values: []string{"en", "de"}, Weights: []float64{3, 1}},
+			regex,
+		},
+	})
+
+	b := new(bytes.Buffer)
+	if err := writeTestsFile(b, test); err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "rq0r-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "tests.yaml")
+	if err := ioutil.WriteFile(path, b.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := app.LoadTests(path, app.LoadOptions{Strict: true})
+	if err != nil {
+		t.Fatalf("Unable to load the dumped tests file:\n%s\n%s", b, err)
+	}
+	if len(loaded) != 1 {
+		t.Fatalf("Expected 1 test, got %d", len(loaded))
+	}
+	l := loaded[0]
+	if l.ID != test.ID || l.NumRequests != test.NumRequests || l.Concurrency != test.Concurrency ||
+		l.Method != test.Method || l.Body != test.Body || !reflect.DeepEqual(l.Header, test.Header) {
+		t.Errorf("Loaded test differs, wanted %+v, got %+v", test, l)
+	}
+	if len(l.Specs) != len(test.Specs) {
+		t.Fatalf("Expected %d urlSpecs, got %d", len(test.Specs), len(l.Specs))
+	}
+	for i, spec := range test.Specs {
+		if !reflect.DeepEqual(l.Specs[i].Components, spec.Components) {
+			t.Errorf("urlSpec %d: wanted components %+v, got %+v", i, spec.Components, l.Specs[i].Components)
+		}
+		if l.Specs[i].Scheme != spec.Scheme || l.Specs[i].Host != spec.Host {
+			t.Errorf("urlSpec %d: wanted %s://%s, got %s://%s", i, spec.Scheme, spec.Host, l.Specs[i].Scheme, l.Specs[i].Host)
+		}
+	}
+}
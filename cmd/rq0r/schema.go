@@ -0,0 +1,32 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/pbaettig/request0r/internal/app"
+	log "github.com/sirupsen/logrus"
+)
+
+// runSchema implements the schema command, it prints the JSON Schema of
+// tests files and returns the exit code
+func runSchema(args []string) int {
+	if len(args) > 0 {
+		fmt.Println(`rq0r schema prints the JSON Schema of tests files, which editors can use for
+autocompletion and validation.
+
+USAGE:
+	rq0r schema > tests.schema.json`)
+		return 1
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(app.JSONSchema()); err != nil {
+		log.Errorf("Unable to write schema: %s", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/pbaettig/request0r/internal/app"
+)
+
+func validateUsage(fs *flag.FlagSet) func() {
+	return func() {
+		fmt.Println(`rq0r validate checks tests files without running them and lists all problems
+with their position in the file.
+
+USAGE:
+	rq0r validate [PARAMETERS] <tests.yaml> [<tests.yaml> ...]
+
+Every argument can be a file, a directory, a glob pattern or - to read from
+stdin. Arguments are checked separately.`)
+		fmt.Println()
+
+		fmt.Println("PARAMETERS:")
+		fs.PrintDefaults()
+	}
+}
+
+// runValidate implements the validate command and returns the exit code
+func runValidate(args []string) int {
+	var (
+		strict bool
+		format string
+	)
+	vars := make(varsFlag)
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	fs.BoolVar(&strict, "strict", false, "Reject unknown fields instead of warning about them")
+	addVarsFlag(fs, vars)
+	addFormatFlag(fs, "format", &format)
+	fs.Usage = validateUsage(fs)
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 1
+	}
+
+	code := 0
+	for _, filename := range fs.Args() {
+		tests, err := app.LoadTestsFromFiles([]string{filename}, app.LoadOptions{
+			Strict: strict,
+			Vars:   vars,
+			Format: format,
+			Warn: func(e *app.ValidationError) {
+				fmt.Printf("%s (warning)\n", e)
+			},
+		})
+		if err != nil {
+			printLoadError(os.Stdout, err)
+			code = 1
+			continue
+		}
+		if filename == app.Stdin {
+			filename = "stdin"
+		}
+		fmt.Printf("%s: OK, %d tests\n", filename, len(tests))
+	}
+	return code
+}
+
+// printLoadError writes err returned by app.LoadTestsFromFile to w, every
+// validation error on its own line
+func printLoadError(w io.Writer, err error) {
+	if errs, ok := err.(app.ValidationErrors); ok {
+		for _, e := range errs {
+			fmt.Fprintln(w, e)
+		}
+		return
+	}
+	fmt.Fprintln(w, err)
+}
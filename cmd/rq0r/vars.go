@@ -0,0 +1,33 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// varsFlag collects the values of a repeatable -var key=value flag
+type varsFlag map[string]string
+
+func (v varsFlag) String() string {
+	pairs := make([]string, 0, len(v))
+	for k, val := range v {
+		pairs = append(pairs, k+"="+val)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (v varsFlag) Set(s string) error {
+	i := strings.IndexByte(s, '=')
+	if i <= 0 {
+		return fmt.Errorf("expected key=value, got %q", s)
+	}
+	v[s[:i]] = s[i+1:]
+	return nil
+}
+
+func addVarsFlag(fs *flag.FlagSet, vars varsFlag) {
+	fs.Var(vars, "var", "Set a variable used for ${NAME} in the tests file, overrides environment variables, can be repeated (key=value)")
+}
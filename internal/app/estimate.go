@@ -0,0 +1,213 @@
+package app
+
+import (
+	"math"
+	"net/url"
+	"sort"
+	"time"
+)
+
+// Estimate is the load a test is expected to generate, as far as it can be
+// known without sending requests
+type Estimate struct {
+	Test *Test
+	// Requests is the expected number of requests, 0 if unknown because
+	// the test runs unthrottled for its Duration
+	Requests int
+	// RequestsPerSecond is the rate the test is throttled to, 0 if it is
+	// unthrottled
+	RequestsPerSecond float64
+	// Duration is the expected run time of the test. For unthrottled tests
+	// it is the Duration of the test, which is an upper bound, or 0 if
+	// unknown.
+	Duration time.Duration
+	// Start is the time the test is expected to start after the run
+	// started, Scheduled is false if it is unknown because the test waits
+	// for tests of unknown duration
+	Start     time.Duration
+	Scheduled bool
+	// Hosts are the scheme and host of the URLs of the test and of its
+	// setup and teardown requests, e.g. https://shop.local
+	Hosts []string
+}
+
+// End returns the time the test is expected to finish after the run
+// started, it is only meaningful if the test is Scheduled and its Duration
+// is known
+func (e Estimate) End() time.Duration {
+	return e.Start + e.Duration
+}
+
+// Plan is the expected load of running tests together
+type Plan struct {
+	Tests []Estimate
+	// PeakRequestsPerSecond is the highest total rate of the throttled
+	// tests running at the same time. Tests with an unknown start are
+	// assumed to run at the same time as all others.
+	PeakRequestsPerSecond float64
+	// Unthrottled contains the IDs of the tests without a rate limit, their
+	// load depends on how fast the target responds
+	Unthrottled []string
+	// Duration is the expected time until all tests have finished, 0 if
+	// unknown
+	Duration time.Duration
+	Hosts    []string
+}
+
+// EstimateTests estimates the load of running tests, taking their
+// dependencies into account
+func EstimateTests(tests []*Test) Plan {
+	var plan Plan
+	byID := make(map[string]int)
+	for i, t := range tests {
+		byID[t.ID] = i
+		plan.Tests = append(plan.Tests, estimate(t))
+		if plan.Tests[i].RequestsPerSecond == 0 {
+			plan.Unthrottled = append(plan.Unthrottled, t.ID)
+		}
+	}
+
+	// schedule sets the start of the test with index i once the starts of
+	// its dependencies are known
+	done := make(map[int]bool)
+	var schedule func(i int)
+	schedule = func(i int) {
+		if done[i] {
+			return
+		}
+		done[i] = true
+		e := &plan.Tests[i]
+		e.Scheduled = true
+		if len(e.Test.DependsOn) == 0 {
+			return
+		}
+		for _, id := range e.Test.DependsOn {
+			d, ok := byID[id]
+			if !ok {
+				continue
+			}
+			schedule(d)
+			dep := plan.Tests[d]
+			if !dep.Scheduled || dep.Duration == 0 {
+				e.Scheduled = false
+			} else if dep.End() > e.Start {
+				e.Start = dep.End()
+			}
+		}
+		e.Start += e.Test.Pause
+	}
+	for i := range plan.Tests {
+		schedule(i)
+	}
+
+	plan.PeakRequestsPerSecond = peakRate(plan.Tests)
+
+	hosts := make(map[string]bool)
+	complete := true
+	for _, e := range plan.Tests {
+		for _, h := range e.Hosts {
+			hosts[h] = true
+		}
+		if !e.Scheduled || e.Duration == 0 {
+			complete = false
+		} else if e.End() > plan.Duration {
+			plan.Duration = e.End()
+		}
+	}
+	if !complete {
+		plan.Duration = 0
+	}
+	plan.Hosts = sortedKeys(hosts)
+	return plan
+}
+
+// estimate returns the Estimate of t without its start
+func estimate(t *Test) Estimate {
+	e := Estimate{Test: t}
+
+	// Every worker is throttled to an equal integer share of the target
+	// rate, see runWorker
+	if t.TargetRequestsPerSecond > 0 && t.Concurrency > 0 {
+		e.RequestsPerSecond = float64(t.TargetRequestsPerSecond / t.Concurrency * t.Concurrency)
+	}
+
+	if !t.IsUnlimited() {
+		e.Requests = t.TotalRequests()
+	}
+	switch {
+	case e.RequestsPerSecond > 0 && t.IsUnlimited():
+		e.Duration = t.Duration
+		e.Requests = int(e.RequestsPerSecond * t.Duration.Seconds())
+	case e.RequestsPerSecond > 0:
+		e.Duration = time.Duration(math.Ceil(float64(e.Requests)/e.RequestsPerSecond)) * time.Second
+		if t.Duration > 0 && e.Duration > t.Duration {
+			e.Duration = t.Duration
+			e.Requests = int(e.RequestsPerSecond * t.Duration.Seconds())
+		}
+	default:
+		e.Duration = t.Duration
+	}
+
+	hosts := make(map[string]bool)
+	for _, s := range t.Specs {
+		hosts[s.Scheme+"://"+s.Host] = true
+	}
+	requests := append(append([]*Request{}, t.Setup...), t.Teardown...)
+	if t.Suite != nil {
+		requests = append(append(requests, t.Suite.Setup...), t.Suite.Teardown...)
+	}
+	for _, r := range requests {
+		if u, err := url.Parse(r.URL); err == nil && u.Host != "" {
+			hosts[u.Scheme+"://"+u.Host] = true
+		}
+	}
+	e.Hosts = sortedKeys(hosts)
+	return e
+}
+
+// peakRate returns the highest total rate of the throttled tests in es
+// running at the same time
+func peakRate(es []Estimate) float64 {
+	type event struct {
+		at   time.Duration
+		rate float64
+	}
+	var (
+		events    []event
+		unplanned float64
+	)
+	for _, e := range es {
+		switch {
+		case e.RequestsPerSecond == 0:
+		case !e.Scheduled || e.Duration == 0:
+			unplanned += e.RequestsPerSecond
+		default:
+			events = append(events, event{e.Start, e.RequestsPerSecond}, event{e.End(), -e.RequestsPerSecond})
+		}
+	}
+	// Tests ending at the same time another one starts don't overlap
+	sort.Slice(events, func(i, j int) bool {
+		if events[i].at != events[j].at {
+			return events[i].at < events[j].at
+		}
+		return events[i].rate < events[j].rate
+	})
+
+	peak, rate := 0.0, 0.0
+	for _, ev := range events {
+		rate += ev.rate
+		if rate > peak {
+			peak = rate
+		}
+	}
+	return peak + unplanned
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
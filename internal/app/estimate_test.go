@@ -0,0 +1,67 @@
+package app
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pbaettig/request0r/pkg/randurl"
+)
+
+func TestEstimateTests(t *testing.T) {
+	spec := randurl.URLSpec{Scheme: "https", Host: "shop.local"}
+	tests := []*Test{
+		{ID: "warmup", NumRequests: 100, Concurrency: 10, TargetRequestsPerSecond: 50, Specs: []randurl.URLSpec{spec, spec}},
+		{ID: "soak", Duration: time.Minute, Concurrency: 10, TargetRequestsPerSecond: 25, Specs: []randurl.URLSpec{spec},
+			DependsOn: []string{"warmup"}, Pause: 5 * time.Second},
+		{ID: "search", NumRequests: 1000, Duration: 10 * time.Second, Concurrency: 2, TargetRequestsPerSecond: 40,
+			Specs: []randurl.URLSpec{{Scheme: "http", Host: "search.local"}}},
+		{ID: "burst", NumRequests: 10, Concurrency: 10, Specs: []randurl.URLSpec{spec},
+			Setup: []*Request{{URL: "https://auth.local/login"}}},
+		{ID: "after-burst", NumRequests: 10, Concurrency: 1, TargetRequestsPerSecond: 5, Specs: []randurl.URLSpec{spec},
+			DependsOn: []string{"burst"}},
+	}
+	plan := EstimateTests(tests)
+
+	cases := []struct {
+		requests  int
+		rate      float64
+		duration  time.Duration
+		start     time.Duration
+		scheduled bool
+	}{
+		// 200 requests at 50 requests/second
+		{200, 50, 4 * time.Second, 0, true},
+		// Every worker is throttled to 2 requests/second
+		{1200, 20, time.Minute, 9 * time.Second, true},
+		// The duration ends the test before all requests were made
+		{400, 40, 10 * time.Second, 0, true},
+		{10, 0, 0, 0, true},
+		{10, 5, 2 * time.Second, 0, false},
+	}
+	for i, c := range cases {
+		e := plan.Tests[i]
+		if e.Requests != c.requests || e.RequestsPerSecond != c.rate || e.Duration != c.duration || e.Start != c.start || e.Scheduled != c.scheduled {
+			t.Errorf("%s: got %+v, wanted %+v", e.Test.ID, e, c)
+		}
+	}
+
+	// warmup and search run at the same time, after-burst might as well
+	if plan.PeakRequestsPerSecond != 95 {
+		t.Errorf("Expected a peak of 95 requests/second, got %g", plan.PeakRequestsPerSecond)
+	}
+	if !reflect.DeepEqual(plan.Unthrottled, []string{"burst"}) {
+		t.Errorf("Expected burst to be unthrottled, got %v", plan.Unthrottled)
+	}
+	if plan.Duration != 0 {
+		t.Errorf("The duration of the plan should be unknown, got %s", plan.Duration)
+	}
+	if hosts := []string{"http://search.local", "https://auth.local", "https://shop.local"}; !reflect.DeepEqual(plan.Hosts, hosts) {
+		t.Errorf("Expected hosts %v, got %v", hosts, plan.Hosts)
+	}
+
+	plan = EstimateTests(tests[:2])
+	if plan.Duration != 69*time.Second || plan.PeakRequestsPerSecond != 50 {
+		t.Errorf("Expected 69s and a peak of 50 requests/second, got %s and %g", plan.Duration, plan.PeakRequestsPerSecond)
+	}
+}
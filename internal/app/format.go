@@ -0,0 +1,119 @@
+package app
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	yaml "gopkg.in/yaml.v3"
+)
+
+// Formats of tests files
+const (
+	FormatYAML = "yaml"
+	FormatJSON = "json"
+	FormatTOML = "toml"
+)
+
+// Formats returns all supported formats of tests files
+func Formats() []string {
+	return []string{FormatYAML, FormatJSON, FormatTOML}
+}
+
+// isFormat returns true if format is supported
+func isFormat(format string) bool {
+	for _, f := range Formats() {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// formatOf determines the format of file by its extension, files with
+// unknown extensions are YAML
+func formatOf(file string) string {
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".json":
+		return FormatJSON
+	case ".toml":
+		return FormatTOML
+	}
+	return FormatYAML
+}
+
+// decode parses data in format into a document node, it returns nil if
+// data contains no document. JSON is a subset of YAML and parsed by the
+// YAML parser, so problems are reported with their position in the file.
+// TOML documents are converted to nodes without positions.
+func decode(data []byte, format string) (*yaml.Node, error) {
+	if format == FormatTOML {
+		var doc map[string]interface{}
+		if _, err := toml.Decode(string(data), &doc); err != nil {
+			return nil, err
+		}
+		if len(doc) == 0 {
+			return nil, nil
+		}
+		return tomlNode(doc), nil
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, err
+	}
+	if len(root.Content) == 0 {
+		return nil, nil
+	}
+	return root.Content[0], nil
+}
+
+// tomlNode converts a value decoded from TOML into a node. Keys of
+// tables are sorted, as their order is lost while decoding.
+func tomlNode(v interface{}) *yaml.Node {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		n := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			n.Content = append(n.Content, tomlScalar("!!str", k), tomlNode(v[k]))
+		}
+		return n
+	case []map[string]interface{}:
+		n := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		for _, item := range v {
+			n.Content = append(n.Content, tomlNode(item))
+		}
+		return n
+	case []interface{}:
+		n := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		for _, item := range v {
+			n.Content = append(n.Content, tomlNode(item))
+		}
+		return n
+	case string:
+		return tomlScalar("!!str", v)
+	case int64:
+		return tomlScalar("!!int", strconv.FormatInt(v, 10))
+	case float64:
+		return tomlScalar("!!float", strconv.FormatFloat(v, 'g', -1, 64))
+	case bool:
+		return tomlScalar("!!bool", strconv.FormatBool(v))
+	case time.Time:
+		return tomlScalar("!!timestamp", v.Format(time.RFC3339Nano))
+	default:
+		return tomlScalar("!!str", fmt.Sprint(v))
+	}
+}
+
+func tomlScalar(tag, value string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: value}
+}
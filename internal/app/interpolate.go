@@ -0,0 +1,111 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+// interpolate replaces references to variables in all scalar values below
+// n. ${NAME} is replaced by the value of NAME, ${NAME:-default} by default
+// if NAME is undefined or empty and $${ is kept as a literal ${.
+// Variables in l.vars take precedence over the environment.
+func (l *loader) interpolate(n *yaml.Node, path string) {
+	switch n.Kind {
+	case yaml.DocumentNode:
+		for _, c := range n.Content {
+			l.interpolate(c, path)
+		}
+	case yaml.MappingNode:
+		for i := 0; i < len(n.Content); i += 2 {
+			p := n.Content[i].Value
+			if path != "" {
+				p = path + "." + p
+			}
+			l.interpolate(n.Content[i+1], p)
+		}
+	case yaml.SequenceNode:
+		for i, c := range n.Content {
+			l.interpolate(c, fmt.Sprintf("%s[%d]", path, i))
+		}
+	case yaml.ScalarNode:
+		if !strings.Contains(n.Value, "${") {
+			return
+		}
+		v, err := expand(n.Value, l.vars)
+		if err != nil {
+			l.errorf(n, path, "%s", err)
+			return
+		}
+		n.Value = v
+	}
+}
+
+// expand returns s with all variables replaced by their values
+func expand(s string, vars map[string]string) (string, error) {
+	var b strings.Builder
+	for {
+		i := strings.Index(s, "${")
+		if i < 0 {
+			b.WriteString(s)
+			return b.String(), nil
+		}
+		if i > 0 && s[i-1] == '$' {
+			b.WriteString(s[:i-1])
+			b.WriteString("${")
+			s = s[i+2:]
+			continue
+		}
+		b.WriteString(s[:i])
+
+		end := strings.IndexByte(s[i:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("missing } in %q", s[i:])
+		}
+		ref := s[i+2 : i+end]
+		s = s[i+end+1:]
+
+		name, def, hasDefault := ref, "", false
+		if j := strings.Index(ref, ":-"); j >= 0 {
+			name, def, hasDefault = ref[:j], ref[j+2:], true
+		}
+		if !isVariableName(name) {
+			return "", fmt.Errorf("invalid variable name %q", name)
+		}
+
+		v, ok := lookupVariable(name, vars)
+		switch {
+		case hasDefault && v == "":
+			v = def
+		case !ok:
+			return "", fmt.Errorf("undefined variable %s", name)
+		}
+		b.WriteString(v)
+	}
+}
+
+func lookupVariable(name string, vars map[string]string) (string, bool) {
+	if v, ok := vars[name]; ok {
+		return v, true
+	}
+	return os.LookupEnv(name)
+}
+
+// isVariableName reports whether s is a valid name of an environment
+// variable, e.g. HOST or api_token
+func isVariableName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, c := range s {
+		switch {
+		case c == '_', c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		case c >= '0' && c <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
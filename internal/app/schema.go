@@ -0,0 +1,302 @@
+package app
+
+import "sort"
+
+// Schema is a JSON Schema (draft-07) describing a value in a tests file.
+// The schemas below are used both to detect unknown fields while loading
+// and to publish the file format for editors, see JSONSchema.
+type Schema struct {
+	Schema               string             `json:"$schema,omitempty"`
+	Ref                  string             `json:"$ref,omitempty"`
+	Title                string             `json:"title,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties interface{}        `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Const                string             `json:"const,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	OneOf                []*Schema          `json:"oneOf,omitempty"`
+	Definitions          map[string]*Schema `json:"definitions,omitempty"`
+}
+
+// durationPattern matches durations accepted by time.ParseDuration
+const durationPattern = `^-?([0-9]+(\.[0-9]*)?(ns|us|µs|ms|s|m|h))+$|^0$`
+
+func stringSchema(description string) *Schema {
+	return &Schema{Type: "string", Description: description}
+}
+
+func integerSchema(description string) *Schema {
+	return &Schema{Type: "integer", Description: description}
+}
+
+func numberSchema(description string) *Schema {
+	return &Schema{Type: "number", Description: description}
+}
+
+func durationSchema(description string) *Schema {
+	return &Schema{Type: "string", Pattern: durationPattern, Description: description}
+}
+
+func enumSchema(description string, values ...string) *Schema {
+	return &Schema{Type: "string", Enum: values, Description: description}
+}
+
+func listSchema(items *Schema, description string) *Schema {
+	return &Schema{Type: "array", Items: items, Description: description}
+}
+
+// objectSchema returns a schema of a mapping that only allows the given
+// properties
+func objectSchema(description string, required []string, properties map[string]*Schema) *Schema {
+	return &Schema{
+		Type:                 "object",
+		Description:          description,
+		Properties:           properties,
+		Required:             required,
+		AdditionalProperties: false,
+	}
+}
+
+// mapSchema returns a schema of a mapping with arbitrary keys whose values
+// match values
+func mapSchema(values *Schema, description string) *Schema {
+	return &Schema{Type: "object", Description: description, AdditionalProperties: values}
+}
+
+var thresholdsSchema = objectSchema("Limits the test has to stay within to pass", nil, map[string]*Schema{
+	"maxErrorPercent":      numberSchema("Highest acceptable percentage of failed requests"),
+	"minRequestsPerSecond": numberSchema("Lowest acceptable total rate of requests per second"),
+	"maxPercentiles":       mapSchema(durationSchema(""), "Highest acceptable response duration per percentile, e.g. 99: 500ms"),
+	"allowedStatusCodes":   listSchema(integerSchema(""), "The only status codes the responses may have"),
+})
+
+var feederSchema = objectSchema("Provides rows of a data file to feeder components", []string{"name", "file"}, map[string]*Schema{
+	"name":        stringSchema("Name used by feeder components to refer to the feeder"),
+	"file":        stringSchema("Path of the CSV or JSON Lines file, relative to the tests file"),
+	"format":      enumSchema("Format of the file, by default determined by its extension", "csv", "jsonl", "ndjson"),
+	"mode":        enumSchema("Order in which the rows are used", "sequential", "random", "unique"),
+	"onExhausted": enumSchema("What happens once all rows have been used", "wrap", "stop"),
+})
+
+// componentSchemas contains the fields of every component type in addition
+// to the type field
+var componentSchemas = map[string]*Schema{
+	"string": objectSchema("A static string value", []string{"value"}, map[string]*Schema{
+		"value": stringSchema("Value of the component"),
+	}),
+	"integer": objectSchema("A random integer value", []string{"min", "max"}, map[string]*Schema{
+		"min":          integerSchema("Minimum value"),
+		"max":          integerSchema("Maximum value, exclusive"),
+		"distribution": enumSchema("How the values are distributed", "uniform", "zipf", "normal", "exponential"),
+		"s":            numberSchema("Skew of the zipf distribution, > 1"),
+		"v":            numberSchema("Offset of the zipf distribution, >= 1"),
+		"mean":         numberSchema("Mean of the normal distribution"),
+		"stdDev":       numberSchema("Standard deviation of the normal distribution"),
+		"rate":         numberSchema("Rate of the exponential distribution"),
+	}),
+	"randomString": objectSchema("A random string value", nil, map[string]*Schema{
+		"chars":     stringSchema("Characters used by placeholders without a character class"),
+		"format":    stringSchema("Format with placeholders like %s, %1,4s or %{digits}4,4s"),
+		"minLength": integerSchema("Minimum length of placeholders without their own lengths"),
+		"maxLength": integerSchema("Maximum length of placeholders without their own lengths"),
+		"classes":   mapSchema(stringSchema(""), "Additional character classes mapping names to characters"),
+	}),
+	"regex": objectSchema("A random string matching a regular expression", []string{"pattern"}, map[string]*Schema{
+		"pattern": stringSchema("Regular expression in Go syntax"),
+	}),
+	"choice": objectSchema("One of a list of values, optionally weighted", []string{"values"}, map[string]*Schema{
+		"values": {
+			Description: "A list of values or a string with the values separated by |",
+			OneOf:       []*Schema{listSchema(stringSchema(""), ""), stringSchema("")},
+		},
+		"weights": listSchema(numberSchema(""), "One weight per value"),
+	}),
+	"feeder": objectSchema("A value from a row of a feeder", []string{"feeder", "column"}, map[string]*Schema{
+		"feeder": stringSchema("Name of the feeder"),
+		"column": stringSchema("Name of the column"),
+	}),
+	"uuid": objectSchema("A random UUID", nil, map[string]*Schema{
+		"version": integerSchema("4 (random, default) or 7 (time-ordered)"),
+	}),
+	"timestamp": objectSchema("The current time, optionally shifted by a random offset", nil, map[string]*Schema{
+		"format":    stringSchema("rfc3339 (default), date, unix, unixMillis or a Go time layout"),
+		"minOffset": durationSchema("Minimum offset relative to now, e.g. -24h"),
+		"maxOffset": durationSchema("Maximum offset relative to now"),
+	}),
+	"sequence": objectSchema("An increasing integer shared by all workers", nil, map[string]*Schema{
+		"start": integerSchema("First value, default 0"),
+		"step":  integerSchema("Increment, default 1"),
+	}),
+	"hex": objectSchema("Random bytes encoded as hex", []string{"length"}, map[string]*Schema{
+		"length": integerSchema("Number of random bytes"),
+	}),
+	"extracted": objectSchema("A value extracted by a setup request, a random one if several values were extracted", []string{"name"}, map[string]*Schema{
+		"name": stringSchema("Name of the variable the value was extracted to"),
+	}),
+	"httpStatus": objectSchema("A valid HTTP status code", []string{"ranges"}, map[string]*Schema{
+		"ranges": listSchema(integerSchema(""), "Acceptable ranges of the generated code, e.g. 200, 500"),
+	}),
+}
+
+func init() {
+	componentSchemas["enum"] = componentSchemas["choice"]
+	componentSchemas["base64"] = objectSchema("Random bytes encoded as URL-safe base64", []string{"length"}, componentSchemas["hex"].Properties)
+}
+
+// componentTypes returns the valid values of the type field of components
+func componentTypes() []string {
+	types := make([]string, 0, len(componentSchemas))
+	for t := range componentSchemas {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// componentSchema returns the schema of components of type t including
+// the type field
+func componentSchema(t string) *Schema {
+	s := componentSchemas[t]
+	properties := map[string]*Schema{
+		"type": {Type: "string", Const: t},
+	}
+	for name, p := range s.Properties {
+		properties[name] = p
+	}
+	return objectSchema(s.Description, append([]string{"type"}, s.Required...), properties)
+}
+
+// refSchema is the schema of an item of uriComponents that refers to
+// named components
+var refSchema = objectSchema("Inserts the named component or list of components", []string{"ref"}, map[string]*Schema{
+	"ref": stringSchema("Name of the components"),
+})
+
+var extractSchema = objectSchema("Where a value is taken from in the response, exactly one of the fields is required", nil, map[string]*Schema{
+	"json":   stringSchema("Dotted path of a value in a JSON body, e.g. data.items.0.id, * matches all items"),
+	"header": stringSchema("Name of a response header"),
+	"regex":  stringSchema("Regular expression matching the body, the value is its first group or the whole match"),
+})
+
+var requestSchema = objectSchema("A request made once before or after the tests, {{name}} in url, headers and body is replaced by an extracted value", []string{"url"}, map[string]*Schema{
+	"name":         stringSchema("Name of the request used in error messages"),
+	"method":       stringSchema("HTTP method, default GET"),
+	"url":          stringSchema("URL of the request"),
+	"headers":      mapSchema(stringSchema(""), "Headers of the request"),
+	"body":         stringSchema("Body of the request"),
+	"repeat":       integerSchema("Number of times the request is made, {{index}} is replaced by the repetition starting at 0"),
+	"forEach":      stringSchema("Name of a variable, the request is made once for each of its values"),
+	"expectStatus": listSchema(integerSchema(""), "Acceptable status codes, default any 2xx"),
+	"extract":      mapSchema(extractSchema, "Values taken from the response by variable name, used by extracted components and later requests"),
+})
+
+var urlSpecSchema = objectSchema("Describes the components of the generated URLs", nil, map[string]*Schema{
+	"ref":           stringSchema("Name of a top-level urlSpec whose fields are used unless they are set here"),
+	"name":          stringSchema("Name of the urlSpec used in reports and metrics"),
+	"scheme":        enumSchema("Scheme of the URLs", "http", "https"),
+	"host":          stringSchema("Host targeted by the test, optionally with a port"),
+	"weight":        numberSchema("Relative share of the test's requests made to this urlSpec"),
+	"uriComponents": listSchema(nil, "Components of the path, joined by /, or references to named components"),
+})
+
+var testSchema = objectSchema("A test", []string{"id", "urlSpecs"}, map[string]*Schema{
+	"id":                      stringSchema("Name of the test"),
+	"tags":                    listSchema(stringSchema(""), "Names used to select tests with -only and -skip"),
+	"dependsOn":               listSchema(stringSchema(""), "IDs of the tests that need to finish before this test starts, requires execution mode dependsOn"),
+	"numRequests":             integerSchema("Number of requests for every urlSpec, or in total if the urlSpecs have weights"),
+	"duration":                durationSchema("Longest time requests are made for, without numRequests requests are made until it has passed"),
+	"concurrency":             integerSchema("Number of workers executing requests in parallel"),
+	"targetRequestsPerSecond": integerSchema("Target rate of requests per second, 0 for no throttling"),
+	"method":                  stringSchema("HTTP method of the requests, default GET"),
+	"headers":                 mapSchema(stringSchema(""), "Headers sent with every request"),
+	"body":                    stringSchema("Body sent with every request"),
+	"thresholds":              thresholdsSchema,
+	"feeders":                 listSchema(feederSchema, "Feeders providing values to feeder components"),
+	"setup":                   listSchema(requestSchema, "Requests made before the test, outside of the measured time"),
+	"teardown":                listSchema(requestSchema, "Requests made after the test"),
+	"urlSpecs":                listSchema(urlSpecSchema, "The URLs under test"),
+})
+
+// defaultTestFields and defaultURLSpecFields are the fields of tests and
+// urlSpecs that can be set for all of them in the defaults block
+var (
+	defaultTestFields    = []string{"numRequests", "duration", "concurrency", "targetRequestsPerSecond", "method", "headers", "body", "thresholds"}
+	defaultURLSpecFields = []string{"scheme", "host"}
+)
+
+var defaultsSchema = newDefaultsSchema()
+
+func newDefaultsSchema() *Schema {
+	properties := make(map[string]*Schema)
+	for _, name := range defaultTestFields {
+		properties[name] = testSchema.Properties[name]
+	}
+	for _, name := range defaultURLSpecFields {
+		properties[name] = urlSpecSchema.Properties[name]
+	}
+	return objectSchema("Values of test and urlSpec fields used unless they are set by a test or urlSpec", nil, properties)
+}
+
+var executionSchema = objectSchema("Controls the order in which the tests run", nil, map[string]*Schema{
+	"mode":  enumSchema("parallel (default) starts all tests at once, sequential one after the other in the order of the file and dependsOn once the tests in their dependsOn have finished", "parallel", "sequential", "dependsOn"),
+	"pause": durationSchema("Time to wait before starting a test after the tests it waits for have finished"),
+})
+
+var documentSchema = objectSchema("", nil, map[string]*Schema{
+	"execution":  executionSchema,
+	"setup":      listSchema(requestSchema, "Requests made once before all tests"),
+	"teardown":   listSchema(requestSchema, "Requests made once after all tests"),
+	"include":    listSchema(stringSchema(""), "Other tests files whose tests and definitions are added, relative to this file"),
+	"defaults":   defaultsSchema,
+	"urlSpecs":   mapSchema(urlSpecSchema, "Named urlSpecs that tests can refer to with ref"),
+	"components": mapSchema(nil, "Named components or lists of components that uriComponents can refer to with ref"),
+	"tests":      listSchema(testSchema, "The tests to run"),
+})
+
+// JSONSchema returns the JSON Schema of tests files
+func JSONSchema() *Schema {
+	components := &Schema{Description: "A component of the path, its fields depend on its type"}
+	for _, t := range componentTypes() {
+		components.OneOf = append(components.OneOf, componentSchema(t))
+	}
+	components.OneOf = append(components.OneOf, refSchema)
+	component := &Schema{Ref: "#/definitions/component"}
+
+	// Copy the schemas down to uriComponents to fill in the components
+	spec := *urlSpecSchema
+	spec.Properties = copyProperties(urlSpecSchema.Properties)
+	uriComponents := *spec.Properties["uriComponents"]
+	uriComponents.Items = component
+	spec.Properties["uriComponents"] = &uriComponents
+
+	test := *testSchema
+	test.Properties = copyProperties(testSchema.Properties)
+	test.Properties["urlSpecs"] = listSchema(&Schema{Ref: "#/definitions/urlSpec"}, testSchema.Properties["urlSpecs"].Description)
+
+	doc := *documentSchema
+	doc.Schema = "http://json-schema.org/draft-07/schema#"
+	doc.Title = "rq0r tests file"
+	doc.Properties = copyProperties(documentSchema.Properties)
+	doc.Properties["urlSpecs"] = mapSchema(&Schema{Ref: "#/definitions/urlSpec"}, documentSchema.Properties["urlSpecs"].Description)
+	doc.Properties["components"] = mapSchema(&Schema{
+		OneOf: []*Schema{component, listSchema(component, "")},
+	}, documentSchema.Properties["components"].Description)
+	doc.Properties["tests"] = listSchema(&test, documentSchema.Properties["tests"].Description)
+	doc.Definitions = map[string]*Schema{
+		"component": components,
+		"urlSpec":   &spec,
+	}
+	return &doc
+}
+
+func copyProperties(properties map[string]*Schema) map[string]*Schema {
+	c := make(map[string]*Schema, len(properties))
+	for k, v := range properties {
+		c[k] = v
+	}
+	return c
+}
@@ -0,0 +1,38 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+)
+
+func TestJSONSchema_UpToDate(t *testing.T) {
+	published, err := ioutil.ReadFile("../../tests.schema.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	generated := new(bytes.Buffer)
+	enc := json.NewEncoder(generated)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(JSONSchema()); err != nil {
+		t.Fatal(err)
+	}
+	if string(published) != generated.String() {
+		t.Error("tests.schema.json is outdated, regenerate it with: rq0r schema > tests.schema.json")
+	}
+}
+
+func TestJSONSchema_ComponentTypes(t *testing.T) {
+	// Every type in the schema has to be understood by the loader
+	for _, ct := range componentTypes() {
+		l := &loader{}
+		l.loadComponent(ct, object{values: nil}, nil)
+		for _, e := range l.errs {
+			if e.Path == "type" {
+				t.Errorf("Component type %s is not handled by the loader: %s", ct, e)
+			}
+		}
+	}
+}
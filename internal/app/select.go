@@ -0,0 +1,64 @@
+package app
+
+import "path"
+
+// SelectTests returns the tests matching any of the patterns in only, or
+// all tests if only is empty, except the ones matching any pattern in skip.
+// A pattern matches a test if it matches its ID, using the syntax of
+// path.Match, or equals one of its tags.
+//
+// Dependencies on tests that are not selected are replaced by their own
+// dependencies, so the selected tests still run in the same order.
+func SelectTests(tests []*Test, only, skip []string) []*Test {
+	byID := make(map[string]*Test)
+	selected := make(map[string]bool)
+	for _, t := range tests {
+		byID[t.ID] = t
+		if (len(only) == 0 || t.matches(only)) && !t.matches(skip) {
+			selected[t.ID] = true
+		}
+	}
+
+	// dependencies returns the selected tests t has to wait for
+	var dependencies func(t *Test, seen map[string]bool) []string
+	dependencies = func(t *Test, seen map[string]bool) []string {
+		var deps []string
+		for _, id := range t.DependsOn {
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+			if selected[id] {
+				deps = append(deps, id)
+			} else if dep, ok := byID[id]; ok {
+				deps = append(deps, dependencies(dep, seen)...)
+			}
+		}
+		return deps
+	}
+
+	var result []*Test
+	for _, t := range tests {
+		if !selected[t.ID] {
+			continue
+		}
+		t.DependsOn = dependencies(t, make(map[string]bool))
+		result = append(result, t)
+	}
+	return result
+}
+
+// matches returns true if t matches any of patterns, see SelectTests
+func (t *Test) matches(patterns []string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, t.ID); ok {
+			return true
+		}
+		for _, tag := range t.Tags {
+			if tag == p {
+				return true
+			}
+		}
+	}
+	return false
+}
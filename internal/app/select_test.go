@@ -0,0 +1,50 @@
+package app
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSelectTests(t *testing.T) {
+	newTests := func() []*Test {
+		return []*Test{
+			{ID: "warmup", Tags: []string{"setup"}},
+			{ID: "checkout-guest", Tags: []string{"checkout"}, DependsOn: []string{"warmup"}},
+			{ID: "checkout-user", Tags: []string{"checkout", "slow"}, DependsOn: []string{"checkout-guest"}},
+			{ID: "search", DependsOn: []string{"checkout-user"}},
+		}
+	}
+	ids := func(tests []*Test) []string {
+		var ids []string
+		for _, t := range tests {
+			ids = append(ids, t.ID)
+		}
+		return ids
+	}
+
+	cases := []struct {
+		only, skip []string
+		correct    []string
+	}{
+		{nil, nil, []string{"warmup", "checkout-guest", "checkout-user", "search"}},
+		{[]string{"checkout-*"}, nil, []string{"checkout-guest", "checkout-user"}},
+		{[]string{"checkout"}, []string{"slow"}, []string{"checkout-guest"}},
+		{[]string{"setup", "search"}, nil, []string{"warmup", "search"}},
+		{nil, []string{"warmup", "checkout"}, []string{"search"}},
+		{[]string{"unknown"}, nil, nil},
+	}
+	for _, c := range cases {
+		if selected := ids(SelectTests(newTests(), c.only, c.skip)); !reflect.DeepEqual(selected, c.correct) {
+			t.Errorf("only %v, skip %v: selected %v, wanted %v", c.only, c.skip, selected, c.correct)
+		}
+	}
+
+	// search has to wait for warmup, as the tests in between are skipped
+	selected := SelectTests(newTests(), nil, []string{"checkout"})
+	if deps := selected[1].DependsOn; !reflect.DeepEqual(deps, []string{"warmup"}) {
+		t.Errorf("Expected search to depend on warmup, got %v", deps)
+	}
+	if deps := selected[0].DependsOn; len(deps) != 0 {
+		t.Errorf("Expected warmup to have no dependencies, got %v", deps)
+	}
+}
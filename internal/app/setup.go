@@ -0,0 +1,300 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pbaettig/request0r/pkg/randurl"
+	log "github.com/sirupsen/logrus"
+)
+
+// Request is a request made once during the setup or teardown of a Test or
+// Suite. {{name}} in its URL, header values and body is replaced by the
+// first value of the variable name, {{index}} by the number of the
+// repetition starting at 0.
+type Request struct {
+	Name   string
+	Method string
+	URL    string
+	Header http.Header
+	Body   string
+	// Repeat is the number of times the request is made, at least once
+	Repeat int
+	// ForEach makes the request once for every value of the variable
+	// ForEach, {{ForEach}} is replaced by the respective value
+	ForEach string
+	// ExpectStatus lists the acceptable status codes, by default any 2xx
+	ExpectStatus []int
+	// Extract maps variable names to where their values are taken from
+	// in the response
+	Extract map[string]Extractor
+}
+
+// Extractor takes a value from a response, only one of its fields is set
+type Extractor struct {
+	// JSON is the dotted path of a value in a JSON body, e.g.
+	// data.items.0.id. * matches all items of a list or object.
+	JSON string
+	// Header is the name of a response header
+	Header string
+	// Regex matches the body, the value is its first group or the whole
+	// match if it has no groups
+	Regex *regexp.Regexp
+}
+
+// Suite contains the setup and teardown requests of a tests file, made
+// once before and after all its tests
+type Suite struct {
+	Setup     []*Request
+	Teardown  []*Request
+	Variables *randurl.Variables
+
+	// setUp is true once at least part of the setup of s succeeded
+	setUp bool
+}
+
+// maxResponseSize limits how much of a response body is read to extract
+// values
+const maxResponseSize = 10 << 20
+
+var setupClient = &http.Client{Timeout: 30 * time.Second}
+
+var placeholderPattern = regexp.MustCompile(`\{\{(\w+)\}\}`)
+
+// RunSetup makes the setup requests of s. If it fails after some of them
+// succeeded s still has to be torn down, see NeedsTeardown.
+func (s *Suite) RunSetup() error {
+	n, err := runRequests(s.Setup, s.Variables, false)
+	s.setUp = err == nil || n > 0
+	return err
+}
+
+// NeedsTeardown returns true if at least part of the setup of s succeeded
+func (s *Suite) NeedsTeardown() bool {
+	return s.setUp
+}
+
+// RunTeardown makes the teardown requests of s
+func (s *Suite) RunTeardown() error {
+	_, err := runRequests(s.Teardown, s.Variables, true)
+	return err
+}
+
+// RunSetup makes the setup requests of t, the extracted values are used
+// by the variable components of t. If it fails after some of them
+// succeeded t still has to be torn down, see NeedsTeardown.
+func (t *Test) RunSetup() error {
+	n, err := runRequests(t.Setup, t.Variables, false)
+	t.setUp = err == nil || n > 0
+	return err
+}
+
+// NeedsTeardown returns true if at least part of the setup of t succeeded
+func (t *Test) NeedsTeardown() bool {
+	return t.setUp
+}
+
+// RunTeardown makes the teardown requests of t
+func (t *Test) RunTeardown() error {
+	_, err := runRequests(t.Teardown, t.Variables, true)
+	return err
+}
+
+// runRequests makes reqs in order and adds the extracted values to vars.
+// It stops at the first request that fails and returns the number of
+// requests that succeeded before. If skipUnresolved is true requests
+// using variables without values are skipped, e.g. teardown requests for
+// values a failed setup didn't extract.
+func runRequests(reqs []*Request, vars *randurl.Variables, skipUnresolved bool) (int, error) {
+	n := 0
+	for _, r := range reqs {
+		sent, err := r.run(vars, skipUnresolved)
+		n += sent
+		if err != nil {
+			return n, fmt.Errorf("%s: %s", r.Name, err)
+		}
+	}
+	return n, nil
+}
+
+// run makes r and returns how many of its repetitions got an expected
+// status
+func (r *Request) run(vars *randurl.Variables, skipUnresolved bool) (int, error) {
+	n := r.Repeat
+	if n < 1 {
+		n = 1
+	}
+	var each []string
+	if r.ForEach != "" {
+		each = vars.Get(r.ForEach)
+		n = len(each)
+	}
+
+	sent := 0
+	for i := 0; i < n; i++ {
+		var unresolved []string
+		expand := func(s string) string {
+			return placeholderPattern.ReplaceAllStringFunc(s, func(p string) string {
+				name := p[2 : len(p)-2]
+				switch {
+				case name == "index":
+					return strconv.Itoa(i)
+				case name == r.ForEach:
+					return each[i]
+				}
+				if values := vars.Get(name); len(values) > 0 {
+					return values[0]
+				}
+				unresolved = append(unresolved, p)
+				return p
+			})
+		}
+
+		req, err := http.NewRequest(r.Method, expand(r.URL), strings.NewReader(expand(r.Body)))
+		if err != nil {
+			return sent, err
+		}
+		for name, values := range r.Header {
+			for _, v := range values {
+				req.Header.Add(name, expand(v))
+			}
+		}
+		if skipUnresolved && len(unresolved) > 0 {
+			log.Warnf("Skipping request %s, %s not set", r.Name, strings.Join(unresolved, ", "))
+			continue
+		}
+		if host := req.Header.Get("Host"); host != "" {
+			req.Host = host
+		}
+
+		log.Debugf("Setup request %s %s", req.Method, req.URL)
+		resp, err := setupClient.Do(req)
+		if err != nil {
+			return sent, err
+		}
+		body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+		resp.Body.Close()
+		if err != nil {
+			return sent, err
+		}
+
+		if !r.expected(resp.StatusCode) {
+			return sent, fmt.Errorf("unexpected status %s", resp.Status)
+		}
+		// The request succeeded even if values can't be extracted
+		sent++
+		for name, e := range r.Extract {
+			values, err := e.extract(resp.Header, body)
+			if err != nil {
+				return sent, fmt.Errorf("unable to extract %s: %s", name, err)
+			}
+			for _, v := range values {
+				vars.Add(name, v)
+			}
+		}
+	}
+	return sent, nil
+}
+
+// expected returns true if status is acceptable for r
+func (r *Request) expected(status int) bool {
+	if len(r.ExpectStatus) == 0 {
+		return status >= 200 && status < 300
+	}
+	for _, s := range r.ExpectStatus {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// extract returns the values e takes from a response with header and body
+func (e Extractor) extract(header http.Header, body []byte) ([]string, error) {
+	switch {
+	case e.Header != "":
+		values := header[http.CanonicalHeaderKey(e.Header)]
+		if len(values) == 0 {
+			return nil, fmt.Errorf("no header %s", e.Header)
+		}
+		return values, nil
+
+	case e.Regex != nil:
+		m := e.Regex.FindSubmatch(body)
+		if m == nil {
+			return nil, fmt.Errorf("body doesn't match %s", e.Regex)
+		}
+		if len(m) > 1 {
+			return []string{string(m[1])}, nil
+		}
+		return []string{string(m[0])}, nil
+
+	default:
+		dec := json.NewDecoder(bytes.NewReader(body))
+		dec.UseNumber()
+		var doc interface{}
+		if err := dec.Decode(&doc); err != nil {
+			return nil, fmt.Errorf("invalid JSON: %s", err)
+		}
+		values := jsonPath(doc, strings.Split(e.JSON, "."))
+		if len(values) == 0 {
+			return nil, fmt.Errorf("nothing found at %s", e.JSON)
+		}
+		return values, nil
+	}
+}
+
+// jsonPath returns the values at path in doc formatted as strings
+func jsonPath(doc interface{}, path []string) []string {
+	if len(path) == 0 {
+		switch v := doc.(type) {
+		case nil:
+			return nil
+		case string:
+			return []string{v}
+		case json.Number:
+			return []string{v.String()}
+		default:
+			b, _ := json.Marshal(v)
+			return []string{string(b)}
+		}
+	}
+
+	var children []interface{}
+	switch v := doc.(type) {
+	case map[string]interface{}:
+		if path[0] == "*" {
+			keys := make([]string, 0, len(v))
+			for k := range v {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				children = append(children, v[k])
+			}
+		} else if c, ok := v[path[0]]; ok {
+			children = append(children, c)
+		}
+	case []interface{}:
+		if path[0] == "*" {
+			children = v
+		} else if i, err := strconv.Atoi(path[0]); err == nil && i >= 0 && i < len(v) {
+			children = append(children, v[i])
+		}
+	}
+
+	var values []string
+	for _, c := range children {
+		values = append(values, jsonPath(c, path[1:])...)
+	}
+	return values
+}
@@ -0,0 +1,162 @@
+package app
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/pbaettig/request0r/pkg/randurl"
+)
+
+func TestRunSetup(t *testing.T) {
+	var deleted []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/login":
+			w.Header().Set("X-Session", "s1")
+			fmt.Fprint(w, `<input name="csrf" value="c1">`)
+		case r.URL.Path == "/users" && r.Header.Get("Authorization") == "s1 c1":
+			fmt.Fprint(w, `{"users": [{"id": 1}, {"id": 2}]}`)
+		case strings.HasPrefix(r.URL.Path, "/users/") && r.Method == http.MethodDelete:
+			deleted = append(deleted, r.URL.Path)
+		default:
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	defer ts.Close()
+
+	suite := &Suite{
+		Setup: []*Request{{
+			Name:   "login",
+			Method: http.MethodPost,
+			URL:    ts.URL + "/login",
+			Extract: map[string]Extractor{
+				"session": {Header: "X-Session"},
+				"csrf":    {Regex: regexp.MustCompile(`name="csrf" value="(\w+)"`)},
+			},
+		}},
+		Variables: randurl.NewVariables(nil),
+	}
+	test := &Test{
+		Setup: []*Request{{
+			Name:   "users",
+			Method: http.MethodGet,
+			URL:    ts.URL + "/users",
+			Header: http.Header{"Authorization": []string{"{{session}} {{csrf}}"}},
+			Extract: map[string]Extractor{
+				"userID": {JSON: "users.*.id"},
+			},
+		}},
+		Teardown: []*Request{{
+			Name:    "delete users",
+			Method:  http.MethodDelete,
+			URL:     ts.URL + "/users/{{userID}}",
+			ForEach: "userID",
+		}},
+		Variables: randurl.NewVariables(suite.Variables),
+	}
+
+	if err := suite.RunSetup(); err != nil {
+		t.Fatal(err)
+	}
+	if err := test.RunSetup(); err != nil {
+		t.Fatal(err)
+	}
+	if ids := test.Variables.Get("userID"); !reflect.DeepEqual(ids, []string{"1", "2"}) {
+		t.Errorf("Expected user IDs [1 2], got %v", ids)
+	}
+	if err := test.RunTeardown(); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(deleted, []string{"/users/1", "/users/2"}) {
+		t.Errorf("Expected both users to be deleted, got %v", deleted)
+	}
+
+	failing := &Test{
+		Setup: []*Request{{
+			Name:   "forbidden",
+			Method: http.MethodGet,
+			URL:    ts.URL + "/admin",
+		}},
+		Variables: randurl.NewVariables(nil),
+	}
+	if err := failing.RunSetup(); err == nil || !strings.Contains(err.Error(), "forbidden: unexpected status 403") {
+		t.Errorf("Expected the setup to fail with status 403, got %v", err)
+	}
+}
+
+func TestRunSetup_PartialFailure(t *testing.T) {
+	var requests []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		switch r.URL.Path {
+		case "/orders":
+			fmt.Fprint(w, `{"id": "o1"}`)
+		case "/payments":
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer ts.Close()
+
+	test := &Test{
+		Setup: []*Request{{
+			Name:    "order",
+			Method:  http.MethodPost,
+			URL:     ts.URL + "/orders",
+			Extract: map[string]Extractor{"orderID": {JSON: "id"}},
+		}, {
+			Name:    "payment",
+			Method:  http.MethodPost,
+			URL:     ts.URL + "/payments",
+			Extract: map[string]Extractor{"paymentID": {JSON: "id"}},
+		}},
+		Teardown: []*Request{{
+			Name:   "delete payment",
+			Method: http.MethodDelete,
+			URL:    ts.URL + "/payments/{{paymentID}}",
+		}, {
+			Name:   "delete order",
+			Method: http.MethodDelete,
+			URL:    ts.URL + "/orders/{{orderID}}",
+		}},
+		Variables: randurl.NewVariables(nil),
+	}
+
+	if err := test.RunSetup(); err == nil || !strings.Contains(err.Error(), "payment: unexpected status 500") {
+		t.Errorf("Expected the setup to fail with status 500, got %v", err)
+	}
+	if !test.NeedsTeardown() {
+		t.Fatal("Expected a teardown after the order was created")
+	}
+	if err := test.RunTeardown(); err != nil {
+		t.Fatal(err)
+	}
+	// The payment wasn't created, so its teardown request is skipped
+	want := []string{"POST /orders", "POST /payments", "DELETE /orders/o1"}
+	if !reflect.DeepEqual(requests, want) {
+		t.Errorf("Expected requests %v, got %v", want, requests)
+	}
+
+	failing := &Test{
+		Setup:     []*Request{{Name: "payment", Method: http.MethodPost, URL: ts.URL + "/payments"}},
+		Variables: randurl.NewVariables(nil),
+	}
+	if err := failing.RunSetup(); err == nil {
+		t.Error("Expected the setup to fail")
+	}
+	if failing.NeedsTeardown() {
+		t.Error("Expected no teardown if no setup request succeeded")
+	}
+
+	suite := &Suite{Variables: randurl.NewVariables(nil)}
+	if err := suite.RunSetup(); err != nil {
+		t.Fatal(err)
+	}
+	if !suite.NeedsTeardown() {
+		t.Error("Expected a teardown after an empty setup")
+	}
+}
@@ -0,0 +1,134 @@
+package app
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Stdin is the path LoadTestsFromFiles reads from standard input
+const Stdin = "-"
+
+// testsFileExtensions are the extensions of the files loaded from a
+// directory
+var testsFileExtensions = map[string]bool{
+	".yaml": true,
+	".yml":  true,
+	".json": true,
+	".toml": true,
+}
+
+// LoadTestsFromFiles loads the tests of all files in paths, in order. A
+// path can be a file, a glob pattern like tests/*.yaml, a directory whose
+// tests files are loaded in alphabetical order, or Stdin. Files referred
+// to more than once are loaded once. opts.Format only applies to Stdin and
+// files without one of testsFileExtensions. The problems of all files are
+// returned together, test IDs need to be unique across all files.
+func LoadTestsFromFiles(paths []string, opts LoadOptions) ([]*Test, error) {
+	files, err := expandPaths(paths)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		tests []*Test
+		errs  ValidationErrors
+	)
+	for _, file := range files {
+		var loaded []*Test
+		if file == Stdin {
+			stdin := opts.Stdin
+			if stdin == nil {
+				stdin = os.Stdin
+			}
+			loaded, err = LoadTestsFromReader(stdin, "stdin", opts)
+		} else {
+			fileOpts := opts
+			if testsFileExtensions[strings.ToLower(filepath.Ext(file))] {
+				fileOpts.Format = ""
+			}
+			loaded, err = LoadTests(file, fileOpts)
+		}
+		if ve, ok := err.(ValidationErrors); ok {
+			errs = append(errs, ve...)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		tests = append(tests, loaded...)
+	}
+
+	errs = append(errs, duplicateIDs(tests)...)
+	if len(errs) > 0 {
+		return nil, sortErrors(errs)
+	}
+	return tests, nil
+}
+
+// expandPaths returns the files paths refer to, see LoadTestsFromFiles
+func expandPaths(paths []string) ([]string, error) {
+	var files []string
+	seen := make(map[string]bool)
+	add := func(file string) {
+		abs, err := filepath.Abs(file)
+		if err != nil || file == Stdin {
+			abs = file
+		}
+		if !seen[abs] {
+			seen[abs] = true
+			files = append(files, file)
+		}
+	}
+
+	for _, path := range paths {
+		if path == Stdin {
+			add(path)
+			continue
+		}
+
+		if strings.ContainsAny(path, "*?[") {
+			matches, err := filepath.Glob(path)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern %s: %s", path, err)
+			}
+			n := 0
+			for _, m := range matches {
+				if info, err := os.Stat(m); err == nil && !info.IsDir() {
+					add(m)
+					n++
+				}
+			}
+			if n == 0 {
+				return nil, fmt.Errorf("no files match %s", path)
+			}
+			continue
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			add(path)
+			continue
+		}
+		entries, err := ioutil.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		n := 0
+		for _, e := range entries {
+			if !e.IsDir() && testsFileExtensions[strings.ToLower(filepath.Ext(e.Name()))] {
+				add(filepath.Join(path, e.Name()))
+				n++
+			}
+		}
+		if n == 0 {
+			return nil, fmt.Errorf("no tests files in %s", path)
+		}
+	}
+	return files, nil
+}
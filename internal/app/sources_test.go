@@ -0,0 +1,105 @@
+package app
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadTestsFromFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rq0r-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"a.yaml": `tests:
+- id: a
+  numRequests: 1
+  concurrency: 1
+  urlSpecs: [{scheme: https, host: shop.local}]
+`,
+		"b.json":    `{"tests": [{"id": "b", "numRequests": 1, "concurrency": 1, "urlSpecs": [{"scheme": "https", "host": "shop.local"}]}]}`,
+		"notes.txt": "not a tests file",
+	}
+	for name, text := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	a, b := filepath.Join(dir, "a.yaml"), filepath.Join(dir, "b.json")
+
+	ids := func(tests []*Test) []string {
+		var ids []string
+		for _, t := range tests {
+			ids = append(ids, t.ID)
+		}
+		return ids
+	}
+	stdin := `tests:
+- id: piped
+  numRequests: 1
+  concurrency: 1
+  urlSpecs: [{scheme: https, host: shop.local}]
+`
+
+	cases := []struct {
+		paths   []string
+		correct []string
+	}{
+		{[]string{dir}, []string{"a", "b"}},
+		{[]string{filepath.Join(dir, "*.json"), a}, []string{"b", "a"}},
+		{[]string{a, dir, a}, []string{"a", "b"}},
+		{[]string{Stdin, b}, []string{"piped", "b"}},
+	}
+	for _, c := range cases {
+		tests, err := LoadTestsFromFiles(c.paths, LoadOptions{Stdin: strings.NewReader(stdin)})
+		if err != nil {
+			t.Errorf("%v: %s", c.paths, err)
+			continue
+		}
+		if loaded := ids(tests); !reflect.DeepEqual(loaded, c.correct) {
+			t.Errorf("%v: loaded %v, wanted %v", c.paths, loaded, c.correct)
+		}
+	}
+
+	tests, err := LoadTestsFromFiles([]string{a, Stdin}, LoadOptions{Stdin: strings.NewReader(stdin)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tests[0].Source != a || tests[1].Source != "stdin" {
+		t.Errorf("Unexpected sources %s, %s", tests[0].Source, tests[1].Source)
+	}
+
+	// The format only applies to files without a known extension
+	tests, err = LoadTestsFromFiles([]string{a, Stdin}, LoadOptions{Format: FormatJSON, Stdin: strings.NewReader(files["b.json"])})
+	if err != nil || len(tests) != 2 {
+		t.Errorf("Expected a.yaml to be loaded as YAML and stdin as JSON, got %v", err)
+	}
+
+	for _, paths := range [][]string{
+		{filepath.Join(dir, "*.toml")},
+		{filepath.Join(dir, "missing.yaml")},
+		{filepath.Join(dir, "[")},
+	} {
+		if _, err := LoadTestsFromFiles(paths, LoadOptions{}); err == nil {
+			t.Errorf("Expected an error for %v", paths)
+		}
+	}
+
+	// Test IDs need to be unique across files
+	_, err = LoadTestsFromFiles([]string{a, Stdin}, LoadOptions{Stdin: strings.NewReader(strings.Replace(stdin, "piped", "a", 1))})
+	errs, ok := err.(ValidationErrors)
+	if !ok || len(errs) != 1 || errs[0].File != "stdin" || errs[0].Line != 2 || errs[0].Reason != "duplicate test ID a, already used in "+a+":2" {
+		t.Errorf("Expected a duplicate test ID error, got %v", err)
+	}
+
+	_, err = LoadTestsFromReader(strings.NewReader(stdin+strings.TrimPrefix(stdin, "tests:\n")), "stdin", LoadOptions{})
+	if errs, ok := err.(ValidationErrors); !ok || len(errs) != 1 || errs[0].Line != 6 || errs[0].Path != "tests[1].id" {
+		t.Errorf("Expected a duplicate test ID error in line 6, got %v", err)
+	}
+}
@@ -2,9 +2,14 @@ package app
 
 import (
 	"fmt"
+	"hash/fnv"
+	"math/rand"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/pbaettig/request0r/pkg/randurl"
@@ -12,27 +17,172 @@ import (
 )
 
 type Test struct {
-	ID                      string
+	ID   string
+	Tags []string
+	// Source is the tests file t is defined in
+	Source string
+	// DependsOn contains the IDs of the tests that need to finish before
+	// t starts, Pause is waited after they finished
+	DependsOn               []string
+	Pause                   time.Duration
 	Specs                   []randurl.URLSpec
 	NumRequests             int
 	TargetRequestsPerSecond int
 	Concurrency             int
-	Out                     chan WorkerResult
-	Stats                   chan WorkerStats
-	in                      chan string
+	// Duration limits how long requests are made. If NumRequests is 0
+	// requests are made until Duration has passed.
+	Duration   time.Duration
+	Method     string
+	Header     http.Header
+	Body       string
+	Thresholds Thresholds
+	// Setup and Teardown requests are made before and after the test,
+	// values extracted from their responses are stored in Variables
+	Setup     []*Request
+	Teardown  []*Request
+	Variables *randurl.Variables
+	// Suite contains the setup and teardown of the file t was loaded from
+	Suite *Suite
+	// Seed determines the URLs generated by every worker, running a Test
+	// with the same Seed generates the same URLs per worker
+	Seed  int64
+	Out   chan WorkerResult
+	Stats chan WorkerStats
 
-	running   bool
-	waitGroup *sync.WaitGroup
+	// origin is the location of the ID of t, used to report duplicates
+	origin *ValidationError
+	// setUp is true once at least part of the setup of t succeeded
+	setUp bool
+
+	running       int32
+	deadline      time.Time
+	waitGroup     *sync.WaitGroup
+	inFlight      int64
+	activeWorkers int64
+	exhausted     sync.Once
 }
 
-func (t *Test) Start() {
+// IsWeighted returns true if the Specs of t have weights, in which case
+// NumRequests is the total number of requests distributed across all Specs
+// according to their weights. Otherwise NumRequests requests are made for
+// every Spec.
+func (t *Test) IsWeighted() bool {
+	for _, s := range t.Specs {
+		if s.Weight > 0 {
+			return true
+		}
+	}
+	return false
+}
 
-	t.in = make(chan string, len(t.Specs)*t.NumRequests)
-	log.WithFields(log.Fields{
-		"test": t.ID,
-	}).Debugf("Created  in channel %p", t.in)
+// IsUnlimited returns true if t makes requests until its Duration has
+// passed rather than a fixed number of requests
+func (t *Test) IsUnlimited() bool {
+	return t.NumRequests == 0 && t.Duration > 0
+}
+
+// TotalRequests returns the number of requests t will make at most, 0 if
+// t IsUnlimited
+func (t *Test) TotalRequests() int {
+	if t.IsWeighted() {
+		return t.NumRequests
+	}
+	return len(t.Specs) * t.NumRequests
+}
 
-	t.Out = make(chan WorkerResult, len(t.Specs)*t.NumRequests)
+// SpecShare returns the fraction of requests of t that are made to the
+// Spec with index i
+func (t *Test) SpecShare(i int) float64 {
+	if !t.IsWeighted() {
+		return 1 / float64(len(t.Specs))
+	}
+	total := 0.0
+	for _, s := range t.Specs {
+		total += s.Weight
+	}
+	return t.Specs[i].Weight / total
+}
+
+// SpecName returns the name of the Spec with index i
+func (t *Test) SpecName(i int) string {
+	if i < len(t.Specs) && t.Specs[i].Name != "" {
+		return t.Specs[i].Name
+	}
+	return strconv.Itoa(i)
+}
+
+// pickSpec returns the index of a randomly chosen Spec, the probability
+// of each Spec is its weight divided by the sum of all weights
+func (t *Test) pickSpec(r *rand.Rand, totalWeight float64) int {
+	n := r.Float64() * totalWeight
+	for i, s := range t.Specs {
+		if n < s.Weight {
+			return i
+		}
+		n -= s.Weight
+	}
+	return len(t.Specs) - 1
+}
+
+// workerRands returns a source of randomness for every worker of t, all
+// derived from t.Seed and t.ID so tests sharing a Seed don't generate the
+// same URLs
+func (t *Test) workerRands() []*rand.Rand {
+	h := fnv.New64a()
+	h.Write([]byte(t.ID))
+	seeds := rand.New(rand.NewSource(t.Seed ^ int64(h.Sum64())))
+
+	rs := make([]*rand.Rand, t.Concurrency)
+	for i := range rs {
+		rs[i] = rand.New(rand.NewSource(seeds.Int63()))
+	}
+	return rs
+}
+
+// maxSampledRequests limits how many requests SampleURLs goes through to
+// find URLs of every Spec
+const maxSampledRequests = 100000
+
+// SampleURLs returns up to n URLs for every Spec of t that are requested
+// when t is run with its Seed: the ones of the first worker in the order it
+// requests them, followed by the ones of the second worker and so on. Fewer
+// URLs are returned for Specs t doesn't request often enough or once a
+// Feeder is exhausted. Sequential and unique Feeders are used up as if the
+// requests were made.
+func (t *Test) SampleURLs(n int) [][]string {
+	samples := make([][]string, len(t.Specs))
+	totalWeight := 0.0
+	for _, spec := range t.Specs {
+		totalWeight += spec.Weight
+	}
+
+	missing, sampled := n*len(t.Specs), 0
+	for first, r := range t.workerRands() {
+		for req := first; t.IsUnlimited() || req < t.TotalRequests(); req += t.Concurrency {
+			if missing == 0 || sampled == maxSampledRequests {
+				return samples
+			}
+			sampled++
+			s := t.specOf(req, r, totalWeight)
+			u, err := t.Specs[s].GenerateRand(r)
+			if err == randurl.ErrFeederExhausted {
+				return samples
+			}
+			if len(samples[s]) < n {
+				samples[s] = append(samples[s], u)
+				missing--
+			}
+		}
+	}
+	return samples
+}
+
+func (t *Test) Start() {
+	buffer := t.TotalRequests()
+	if t.IsUnlimited() {
+		buffer = t.Concurrency
+	}
+	t.Out = make(chan WorkerResult, buffer)
 	log.WithFields(log.Fields{
 		"test": t.ID,
 	}).Debugf("Created  out channel %p", t.Out)
@@ -47,38 +197,84 @@ func (t *Test) Start() {
 		"test": t.ID,
 	}).Debugf("Created  WaitGroup %p", t.waitGroup)
 
-	// Start Workers
-	for i := 0; i < t.Concurrency; i++ {
-		//t.waitGroup.Add(1)
+	if t.Duration > 0 {
+		t.deadline = time.Now().Add(t.Duration)
+	}
+
+	// Start Workers. running is set before, so the cleanup below always
+	// resets it.
+	atomic.StoreInt32(&t.running, 1)
+	for i, r := range t.workerRands() {
 		wid := fmt.Sprintf("%s-%d", t.ID, i)
 		log.WithFields(log.Fields{
 			"test": t.ID,
 		}).Debugf("Starting worker %s", wid)
-		go t.runWorker(wid)
-		// 60% of the time the Workers don't actually start without sleeping inbetween iterations...
-		time.Sleep(1 * time.Microsecond)
+		t.waitGroup.Add(1)
+		atomic.AddInt64(&t.activeWorkers, 1)
+		go t.runWorker(wid, i, r)
 	}
-	t.running = true
-
-	// Populate in channel
-	log.WithFields(log.Fields{
-		"test": t.ID,
-	}).Debugf("Filling in channel %p...", t.in)
-	for _, spec := range t.Specs {
-		for i := 0; i < t.NumRequests; i++ {
-			t.in <- spec.String()
-		}
-	}
-	close(t.in)
 
 	// Cleanup after all Workers finish
 	go func() {
 		t.waitGroup.Wait()
-		t.running = false
+		atomic.StoreInt32(&t.running, 0)
 		close(t.Out)
 		close(t.Stats)
 	}()
 }
+
+// specOf returns the index of the Spec used for the request with index n
+func (t *Test) specOf(n int, r *rand.Rand, totalWeight float64) int {
+	switch {
+	case t.IsWeighted():
+		return t.pickSpec(r, totalWeight)
+	case t.Duration > 0:
+		// The Specs take turns, as the test might end before all
+		// requests were made
+		return n % len(t.Specs)
+	default:
+		return n / t.NumRequests
+	}
+}
+
+// nextRequest generates the URL of the n-th request of t using r and
+// returns the index of the Spec it was generated from. It returns false
+// if no more URLs can be generated because a feeder ran out of rows.
+func (t *Test) nextRequest(n int, r *rand.Rand, totalWeight float64) (int, string, bool) {
+	s := t.specOf(n, r, totalWeight)
+	u, err := t.Specs[s].GenerateRand(r)
+	if err == randurl.ErrFeederExhausted {
+		t.exhausted.Do(func() {
+			log.WithFields(log.Fields{
+				"test": t.ID,
+			}).Warnf("No more URLs can be generated: %s", err)
+		})
+		return s, "", false
+	}
+	return s, u, true
+}
+
+// newRequest returns the request to u, using the Method, Header and Body
+// of t
+func (t *Test) newRequest(u string) (*http.Request, error) {
+	method := t.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	req, err := http.NewRequest(method, u, strings.NewReader(t.Body))
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range t.Header {
+		req.Header[name] = values
+	}
+	// The Host header is ignored by the client, it's taken from req.Host
+	if host := t.Header.Get("Host"); host != "" {
+		req.Host = host
+	}
+	return req, nil
+}
+
 func (t *Test) Wait() {
 	log.WithFields(log.Fields{
 		"test": t.ID,
@@ -86,19 +282,31 @@ func (t *Test) Wait() {
 	t.waitGroup.Wait()
 }
 
+// IsRunning returns true while workers of t are making requests
 func (t *Test) IsRunning() bool {
-	return t.running
+	return atomic.LoadInt32(&t.running) == 1
+}
+
+// InFlight returns the number of requests currently waiting for a response
+func (t *Test) InFlight() int {
+	return int(atomic.LoadInt64(&t.inFlight))
+}
+
+// ActiveWorkers returns the number of workers that have not finished yet
+func (t *Test) ActiveWorkers() int {
+	return int(atomic.LoadInt64(&t.activeWorkers))
 }
 
-func (t *Test) runWorker(id string) {
-	t.waitGroup.Add(1)
+// runWorker makes every Concurrency-th request of t, starting with the
+// request with index first. All URLs are generated using r.
+func (t *Test) runWorker(id string, first int, r *rand.Rand) {
 	log.WithFields(log.Fields{
 		"test":   t.ID,
 		"worker": id,
 	}).Debugf("Worker starting")
 	workerStart := time.Now()
 	processed := 0
-	defer func(t Test) {
+	defer func() {
 		rt := time.Now().Sub(workerStart)
 
 		log.WithFields(log.Fields{
@@ -115,26 +323,47 @@ func (t *Test) runWorker(id string) {
 			"test":   t.ID,
 			"worker": id,
 		}).Debugf("Finished. Calling Done on waitGroup %p", t.waitGroup)
+		atomic.AddInt64(&t.activeWorkers, -1)
 		t.waitGroup.Done()
-	}(*t)
+	}()
 
-	log.WithFields(log.Fields{
-		"test":   t.ID,
-		"worker": id,
-	}).Debugf("Reading URLs to process from %p", t.in)
-	for _url := range t.in {
+	totalWeight := 0.0
+	for _, spec := range t.Specs {
+		totalWeight += spec.Weight
+	}
+
+	for n := first; t.IsUnlimited() || n < t.TotalRequests(); n += t.Concurrency {
+		if t.Duration > 0 && time.Now().After(t.deadline) {
+			break
+		}
+		spec, u, ok := t.nextRequest(n, r, totalWeight)
+		if !ok {
+			break
+		}
 		log.WithFields(log.Fields{
 			"test":   t.ID,
 			"worker": id,
-		}).Debugf("Processing %s", _url)
+		}).Debugf("Processing %s", u)
 		var result WorkerResult
 
-		result.URL = _url
+		result.URL = u
+		result.Spec = spec
 
 		requestStart := time.Now()
-		resp, err := http.Get(_url)
+		result.Start = requestStart
+		atomic.AddInt64(&t.inFlight, 1)
+		var resp *http.Response
+		req, err := t.newRequest(u)
+		if err == nil {
+			resp, err = http.DefaultClient.Do(req)
+		}
+		atomic.AddInt64(&t.inFlight, -1)
 		if err != nil {
-			result.Error = err.(*url.Error)
+			if ue, ok := err.(*url.Error); ok {
+				result.Error = ue
+			} else {
+				result.Error = &url.Error{Op: t.Method, URL: u, Err: err}
+			}
 		} else {
 			// Don't defer close, we want to get rid of it immediately
 			resp.Body.Close()
@@ -169,6 +398,8 @@ func (t *Test) runWorker(id string) {
 
 type WorkerResult struct {
 	URL             string
+	Spec            int // index of the URLSpec in Test.Specs the URL was generated from
+	Start           time.Time
 	RequestDuration time.Duration
 	StatusCode      int
 	ContentLength   int64
@@ -181,3 +412,33 @@ type WorkerStats struct {
 	RequestsPerSecond float64
 	Runtime           time.Duration
 }
+
+// Thresholds describe the limits a Test has to stay within to pass.
+// Zero values disable the respective check.
+type Thresholds struct {
+	// MaxErrorPercent is the highest acceptable percentage of failed
+	// requests, nil if the error rate should not be checked
+	MaxErrorPercent *float64
+	// MinRequestsPerSecond is the lowest acceptable total throughput
+	MinRequestsPerSecond float64
+	// MaxPercentiles maps a percentile (e.g. 0.99) to the highest
+	// acceptable response duration for it
+	MaxPercentiles map[float64]time.Duration
+	// AllowedStatusCodes lists the only status codes responses may have
+	AllowedStatusCodes []int
+}
+
+// IsEmpty returns true if no thresholds are configured
+func (th Thresholds) IsEmpty() bool {
+	return th.MaxErrorPercent == nil && th.MinRequestsPerSecond == 0 &&
+		len(th.MaxPercentiles) == 0 && len(th.AllowedStatusCodes) == 0
+}
+
+// TestRun bundles a Test with everything that was collected while running it
+type TestRun struct {
+	Test    *Test
+	Results []WorkerResult
+	Stats   []WorkerStats
+	// SetupError is set if the setup of the test failed, it didn't run
+	SetupError error
+}
@@ -0,0 +1,264 @@
+package app
+
+import (
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pbaettig/request0r/pkg/randurl"
+)
+
+func TestTest_pickSpec(t *testing.T) {
+	test := Test{
+		NumRequests: 100,
+		Specs: []randurl.URLSpec{
+			{Host: "item", Weight: 70},
+			{Host: "search", Weight: 25},
+			{Host: "checkout", Weight: 5},
+		},
+	}
+	if !test.IsWeighted() {
+		t.Fatal("Test should be weighted")
+	}
+	if test.TotalRequests() != 100 {
+		t.Errorf("Weighted test should make NumRequests requests in total, got %d", test.TotalRequests())
+	}
+
+	r := rand.New(rand.NewSource(1))
+	const runs = 20000
+	const tolerance = 0.02
+	counts := make([]int, len(test.Specs))
+	for i := 0; i < runs; i++ {
+		counts[test.pickSpec(r, 100)]++
+	}
+	for i, spec := range test.Specs {
+		actual := float64(counts[i]) / runs
+		if share := test.SpecShare(i); actual < share-tolerance || actual > share+tolerance {
+			t.Errorf("Spec %s was picked %.3f of the time, wanted %.3f±%.2f", spec.Host, actual, share, tolerance)
+		}
+	}
+}
+
+func TestTest_TotalRequests(t *testing.T) {
+	test := Test{
+		NumRequests: 10,
+		Specs:       []randurl.URLSpec{{Host: "a"}, {Host: "b"}},
+	}
+	if test.IsWeighted() {
+		t.Fatal("Test should not be weighted")
+	}
+	if test.TotalRequests() != 20 {
+		t.Errorf("Unweighted test should make NumRequests requests per spec, got %d", test.TotalRequests())
+	}
+	if test.SpecShare(1) != 0.5 {
+		t.Errorf("Unweighted specs should have equal shares, got %f", test.SpecShare(1))
+	}
+}
+
+func TestTest_workerRands(t *testing.T) {
+	a := Test{ID: "a", Seed: 42, Concurrency: 3}
+	b := Test{ID: "b", Seed: 42, Concurrency: 3}
+
+	first, second, other := a.workerRands(), a.workerRands(), b.workerRands()
+	for i := range first {
+		x, y, z := first[i].Int63(), second[i].Int63(), other[i].Int63()
+		if x != y {
+			t.Errorf("Worker %d: same seed produced %d and %d", i, x, y)
+		}
+		if x == z {
+			t.Errorf("Worker %d: tests with different IDs produced the same value %d", i, x)
+		}
+	}
+}
+
+func TestTest_SampleURLs(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	newTest := func() *Test {
+		return &Test{
+			ID:          "sample",
+			NumRequests: 30,
+			Concurrency: 1,
+			Seed:        7,
+			Specs: []randurl.URLSpec{
+				{Scheme: "http", Host: host, Weight: 3, Components: []randurl.PathComponent{randurl.StringComponent("a"), randurl.RandomIntegerComponent{Min: 0, Max: 1000000}}},
+				{Scheme: "http", Host: host, Weight: 1, Components: []randurl.PathComponent{randurl.StringComponent("b"), randurl.RandomIntegerComponent{Min: 0, Max: 1000000}}},
+			},
+		}
+	}
+
+	// The samples are the first URLs of every Spec actually requested by
+	// the first worker
+	test := newTest()
+	test.Start()
+	requested := make([][]string, len(test.Specs))
+	for r := range test.Out {
+		if r.Error != nil {
+			t.Fatal(r.Error)
+		}
+		if len(requested[r.Spec]) < 3 {
+			requested[r.Spec] = append(requested[r.Spec], r.URL)
+		}
+	}
+
+	if samples := newTest().SampleURLs(3); !reflect.DeepEqual(samples, requested) {
+		t.Errorf("Sampled URLs %v, but %v were requested", samples, requested)
+	}
+
+	// More samples than the first worker requests are taken from the
+	// other workers
+	test = newTest()
+	test.Concurrency = 4
+	test.Start()
+	var all []string
+	for r := range test.Out {
+		all = append(all, r.URL)
+	}
+	samples := newTest()
+	samples.Concurrency = 4
+	sampled := samples.SampleURLs(30)
+	got := append(append([]string{}, sampled[0]...), sampled[1]...)
+	sort.Strings(all)
+	sort.Strings(got)
+	if !reflect.DeepEqual(got, all) {
+		t.Errorf("Sampled URLs %v, but %v were requested", got, all)
+	}
+}
+
+func TestTest_Start(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	run := func() map[string]int {
+		test := Test{
+			ID:          "start",
+			NumRequests: 20,
+			Concurrency: 3,
+			Seed:        7,
+			Specs: []randurl.URLSpec{
+				{Scheme: "http", Host: host, Components: []randurl.PathComponent{randurl.StringComponent("a"), randurl.RandomIntegerComponent{Min: 0, Max: 1000000}}},
+				{Scheme: "http", Host: host, Components: []randurl.PathComponent{randurl.StringComponent("b"), randurl.RandomIntegerComponent{Min: 0, Max: 1000000}}},
+			},
+		}
+		test.Start()
+
+		urls := make(map[string]int)
+		specs := make([]int, len(test.Specs))
+		for r := range test.Out {
+			if r.Error != nil {
+				t.Fatal(r.Error)
+			}
+			urls[r.URL]++
+			specs[r.Spec]++
+		}
+		for i, n := range specs {
+			if n != test.NumRequests {
+				t.Errorf("Spec %d: expected %d requests, got %d", i, test.NumRequests, n)
+			}
+		}
+		return urls
+	}
+
+	if first, second := run(), run(); !reflect.DeepEqual(first, second) {
+		t.Errorf("Runs with the same seed generated different URLs")
+	}
+}
+
+func TestTest_StartDuration(t *testing.T) {
+	requests := make(chan *http.Request, 1000)
+	bodies := make(chan string, 1000)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		requests <- r
+		bodies <- string(body)
+	}))
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	test := Test{
+		ID:                      "duration",
+		Duration:                300 * time.Millisecond,
+		Concurrency:             2,
+		TargetRequestsPerSecond: 20,
+		Method:                  http.MethodPut,
+		Header:                  http.Header{"X-Token": {"abc"}, "Host": {"shop.local"}},
+		Body:                    `{"id":1}`,
+		Specs: []randurl.URLSpec{
+			{Scheme: "http", Host: host, Components: []randurl.PathComponent{randurl.StringComponent("a")}},
+			{Scheme: "http", Host: host, Components: []randurl.PathComponent{randurl.StringComponent("b")}},
+		},
+	}
+	if !test.IsUnlimited() {
+		t.Fatal("Test without NumRequests should be unlimited")
+	}
+
+	start := time.Now()
+	test.Start()
+	specs := make([]int, len(test.Specs))
+	for r := range test.Out {
+		if r.Error != nil {
+			t.Fatal(r.Error)
+		}
+		specs[r.Spec]++
+	}
+	if d := time.Now().Sub(start); d < test.Duration || d > 2*time.Second {
+		t.Errorf("Test should have run for about %s, ran for %s", test.Duration, d)
+	}
+	if specs[0] == 0 || specs[1] == 0 {
+		t.Errorf("Expected requests to all specs, got %v", specs)
+	}
+
+	close(requests)
+	close(bodies)
+	for r := range requests {
+		if r.Method != http.MethodPut || r.Header.Get("X-Token") != "abc" || r.Host != "shop.local" {
+			t.Errorf("Request sent incorrectly: %s %s %v", r.Method, r.Host, r.Header)
+		}
+		if body := <-bodies; body != test.Body {
+			t.Errorf("Expected body %s, got %s", test.Body, body)
+		}
+	}
+}
+
+func TestTest_IsRunning(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Millisecond)
+	}))
+	defer server.Close()
+
+	test := Test{
+		ID:          "running",
+		NumRequests: 20,
+		Concurrency: 2,
+		Specs:       []randurl.URLSpec{{Scheme: "http", Host: strings.TrimPrefix(server.URL, "http://")}},
+	}
+	test.Start()
+	if !test.IsRunning() {
+		t.Error("Test should be running once started")
+	}
+
+	// IsRunning is polled concurrently, e.g. by the metrics handler
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for test.IsRunning() {
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	for range test.Out {
+	}
+	test.Wait()
+	<-done
+	if test.IsRunning() {
+		t.Error("Test should not be running after all workers finished")
+	}
+}
@@ -0,0 +1,369 @@
+package app
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pbaettig/request0r/pkg/randurl"
+	yaml "gopkg.in/yaml.v3"
+)
+
+// ValidationError describes a problem with a value in a tests file
+type ValidationError struct {
+	File   string
+	Line   int
+	Column int
+	// Path is the location of the value in the document,
+	// e.g. tests[0].urlSpecs[1].host
+	Path   string
+	Reason string
+}
+
+func (e *ValidationError) Error() string {
+	var b strings.Builder
+	b.WriteString(e.File)
+	if e.Line > 0 {
+		fmt.Fprintf(&b, ":%d:%d", e.Line, e.Column)
+	}
+	if e.Path != "" {
+		fmt.Fprintf(&b, ": %s", e.Path)
+	}
+	fmt.Fprintf(&b, ": %s", e.Reason)
+	return b.String()
+}
+
+// ValidationErrors contains all problems found in a tests file
+type ValidationErrors []*ValidationError
+
+func (es ValidationErrors) Error() string {
+	lines := make([]string, len(es))
+	for i, e := range es {
+		lines[i] = e.Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// loader walks the nodes of a tests file and collects all problems
+// it finds along the way
+type loader struct {
+	file   string
+	format string
+	strict bool
+	vars   map[string]string
+	defs   definitions
+	suite  *Suite
+	// suiteExtracted are the names of the variables extracted by the
+	// setup of the file
+	suiteExtracted map[string]bool
+	// variables and extracted are the variables of the test being loaded
+	// and the names of the ones extracted by its setup
+	variables *randurl.Variables
+	extracted map[string]bool
+	// files maps the nodes of included files to their file
+	files    map[*yaml.Node]string
+	errs     ValidationErrors
+	warnings ValidationErrors
+}
+
+// errorf records a problem with n, which can be nil if the problem
+// concerns the document as a whole
+func (l *loader) errorf(n *yaml.Node, path string, format string, args ...interface{}) {
+	e := l.locate(n, path)
+	e.Reason = fmt.Sprintf(format, args...)
+	l.errs = append(l.errs, e)
+}
+
+// locate returns an error without reason at the position of n
+func (l *loader) locate(n *yaml.Node, path string) *ValidationError {
+	e := &ValidationError{
+		File: l.file,
+		Path: path,
+	}
+	if n != nil {
+		e.Line, e.Column = n.Line, n.Column
+		if file, ok := l.files[n]; ok {
+			e.File = file
+		}
+	}
+	return e
+}
+
+// addFile records that n and all nodes below it are part of file
+func (l *loader) addFile(n *yaml.Node, file string) {
+	if l.files == nil {
+		l.files = make(map[*yaml.Node]string)
+	}
+	l.files[n] = file
+	for _, c := range n.Content {
+		l.addFile(c, file)
+	}
+}
+
+// checkFields records the keys of o that are not properties of s, as
+// errors in strict mode and as warnings otherwise
+func (l *loader) checkFields(o object, s *Schema) {
+	if o.node == nil {
+		return
+	}
+	for i := 0; i < len(o.node.Content); i += 2 {
+		key := o.node.Content[i]
+		if _, ok := s.Properties[key.Value]; ok {
+			continue
+		}
+
+		path := key.Value
+		if o.path != "" {
+			path = o.path + "." + key.Value
+		}
+		reason := "unknown field"
+		if suggestion := closest(key.Value, s.Properties); suggestion != "" {
+			reason += fmt.Sprintf(", did you mean %s?", suggestion)
+		}
+
+		errs := len(l.errs)
+		l.errorf(key, path, "%s", reason)
+		if !l.strict {
+			l.warnings = append(l.warnings, l.errs[errs:]...)
+			l.errs = l.errs[:errs]
+		}
+	}
+}
+
+// closest returns the property most similar to name if it is likely
+// a typo of it
+func closest(name string, properties map[string]*Schema) string {
+	best, bestDistance := "", 3
+	for p := range properties {
+		if d := editDistance(strings.ToLower(name), strings.ToLower(p)); d < bestDistance || (d == bestDistance && p < best) {
+			best, bestDistance = p, d
+		}
+	}
+	return best
+}
+
+// editDistance returns the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+var yamlErrorLine = regexp.MustCompile(`^yaml: line (\d+): (.*)$`)
+
+// syntaxError records an error returned by the YAML or TOML parser for
+// file
+func (l *loader) syntaxError(file string, err error) {
+	e := &ValidationError{File: file, Reason: err.Error()}
+	if pe, ok := err.(toml.ParseError); ok {
+		e.Line, e.Column = pe.Position.Line, pe.Position.Col
+		e.Reason = pe.Message
+	} else if m := yamlErrorLine.FindStringSubmatch(err.Error()); m != nil {
+		e.Line, _ = strconv.Atoi(m[1])
+		e.Reason = m[2]
+	}
+	l.errs = append(l.errs, e)
+}
+
+// field is a value of a mapping, node is nil if the key is not set
+type field struct {
+	parent *yaml.Node
+	node   *yaml.Node
+	path   string
+}
+
+func (f field) isSet() bool {
+	return f.node != nil
+}
+
+// object is a mapping whose values can be looked up by key
+type object struct {
+	node   *yaml.Node
+	path   string
+	values map[string]*yaml.Node
+}
+
+// get returns the field key of o
+func (o object) get(key string) field {
+	f := field{parent: o.node, path: key}
+	if o.path != "" {
+		f.path = o.path + "." + key
+	}
+	if n, ok := o.values[key]; ok && n.Tag != "!!null" {
+		f.node = n
+	}
+	return f
+}
+
+func kindName(n *yaml.Node) string {
+	switch n.Kind {
+	case yaml.MappingNode:
+		return "a mapping"
+	case yaml.SequenceNode:
+		return "a list"
+	default:
+		return fmt.Sprintf("%q", n.Value)
+	}
+}
+
+// required records an error if f is not set and returns whether it is
+func (l *loader) required(f field) bool {
+	if !f.isSet() {
+		l.errorf(f.parent, f.path, "missing required field")
+		return false
+	}
+	return true
+}
+
+// object returns the mapping in f, it is empty if f is not set
+func (l *loader) object(f field) object {
+	o := object{node: f.node, path: f.path, values: make(map[string]*yaml.Node)}
+	if !f.isSet() {
+		return o
+	}
+	n := f.node
+	if n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+	if n.Kind != yaml.MappingNode {
+		l.errorf(n, f.path, "expected a mapping, got %s", kindName(n))
+		o.node = nil
+		return o
+	}
+	o.node = n
+	for i := 0; i < len(n.Content); i += 2 {
+		o.values[n.Content[i].Value] = n.Content[i+1]
+	}
+	return o
+}
+
+// list returns the items of the sequence in f
+func (l *loader) list(f field) []field {
+	if !f.isSet() {
+		return nil
+	}
+	n := f.node
+	if n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+	if n.Kind != yaml.SequenceNode {
+		l.errorf(n, f.path, "expected a list, got %s", kindName(n))
+		return nil
+	}
+	items := make([]field, len(n.Content))
+	for i, item := range n.Content {
+		items[i] = field{parent: n, node: item, path: fmt.Sprintf("%s[%d]", f.path, i)}
+	}
+	return items
+}
+
+// scalar returns the value of f if it is a scalar
+func (l *loader) scalar(f field, expected string) (string, bool) {
+	if !f.isSet() {
+		return "", false
+	}
+	n := f.node
+	if n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+	if n.Kind != yaml.ScalarNode {
+		l.errorf(n, f.path, "expected %s, got %s", expected, kindName(n))
+		return "", false
+	}
+	return n.Value, true
+}
+
+// str returns the string in f, or "" if f is not set
+func (l *loader) str(f field) string {
+	s, _ := l.scalar(f, "a string")
+	return s
+}
+
+// strs returns the list of strings in f, or nil if f is not set
+func (l *loader) strs(f field) []string {
+	var ss []string
+	for _, item := range l.list(f) {
+		ss = append(ss, l.str(item))
+	}
+	return ss
+}
+
+// int returns the integer in f, or 0 if f is not set
+func (l *loader) int(f field) int {
+	s, ok := l.scalar(f, "an integer")
+	if !ok {
+		return 0
+	}
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		l.errorf(f.node, f.path, "expected an integer, got %q", s)
+	}
+	return i
+}
+
+// positiveInt returns the integer in the required field f and records an
+// error if it is not greater than 0
+func (l *loader) positiveInt(f field) int {
+	if !l.required(f) {
+		return 0
+	}
+	errs := len(l.errs)
+	i := l.int(f)
+	if len(l.errs) == errs && i <= 0 {
+		l.errorf(f.node, f.path, "must be greater than 0")
+	}
+	return i
+}
+
+// float returns the number in f, or 0 if f is not set
+func (l *loader) float(f field) float64 {
+	s, ok := l.scalar(f, "a number")
+	if !ok {
+		return 0
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		l.errorf(f.node, f.path, "expected a number, got %q", s)
+	}
+	return v
+}
+
+// duration returns the duration in f, e.g. 500ms, or 0 if f is not set
+func (l *loader) duration(f field) time.Duration {
+	s, ok := l.scalar(f, "a duration")
+	if !ok {
+		return 0
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		l.errorf(f.node, f.path, "expected a duration like 500ms or 1h, got %q", s)
+	}
+	return d
+}
@@ -1,143 +1,1146 @@
 package app
 
 import (
+	"fmt"
+	"io"
 	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/pbaettig/request0r/pkg/randurl"
-	yaml "gopkg.in/yaml.v2"
-
 	log "github.com/sirupsen/logrus"
+	yaml "gopkg.in/yaml.v3"
 )
 
-// Stub for parsing root of yaml document
-type doc struct {
-	Tests []testYaml `yaml:"tests"`
+// LoadOptions control how tests files are loaded
+type LoadOptions struct {
+	// Strict rejects unknown fields, otherwise they are passed to Warn
+	Strict bool
+	// Warn is called for problems that don't prevent the tests from
+	// being loaded, by default they are logged
+	Warn func(*ValidationError)
+	// Vars are substituted for ${NAME} in values of the file, before
+	// falling back to environment variables
+	Vars map[string]string
+	// Format is one of Formats, by default it is determined by the file
+	// extension. Included files are always read according to their
+	// extension.
+	Format string
+	// Stdin is read by LoadTestsFromFiles for the path -, os.Stdin by
+	// default
+	Stdin io.Reader
 }
 
-// Stub for parsing Test objects
-type testYaml struct {
-	ID                      string        `yaml:"id"`
-	Specs                   []urlSpecYaml `yaml:"urlSpecs"`
-	NumRequests             int           `yaml:"numRequests"`
-	TargetRequestsPerSecond int           `yaml:"targetRequestsPerSecond"`
-	Concurrency             int           `yaml:"concurrency"`
+// LoadTestsFromFile parses the specified yaml file and return a slice of *Test.
+// If the file contains invalid values the returned error is a
+// ValidationErrors listing all of them.
+func LoadTestsFromFile(path string) ([]*Test, error) {
+	return LoadTests(path, LoadOptions{})
+}
+
+// LoadTests is like LoadTestsFromFile but uses opts
+func LoadTests(path string, opts LoadOptions) ([]*Test, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return load(data, path, opts)
 }
 
-// Stub for parsing randurl.URLSpec
-type urlSpecYaml struct {
-	Scheme     string                        `yaml:"scheme"`
-	Host       string                        `yaml:"host"`
-	Components []map[interface{}]interface{} `yaml:"uriComponents"`
+// LoadTestsFromReader is like LoadTests but reads the tests from r. name
+// is used as file name in messages, unless set in opts the format is
+// determined by its extension and relative paths are resolved relative to
+// its directory.
+func LoadTestsFromReader(r io.Reader, name string, opts LoadOptions) ([]*Test, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return load(data, name, opts)
 }
 
-func castString(sourceValue interface{}) string {
-	switch sourceValue.(type) {
-	case string:
-		return sourceValue.(string)
-	case int:
-		return strconv.Itoa(sourceValue.(int))
-	default:
-		log.Fatalln("Uh oh")
+// load loads the tests in data read from path
+func load(data []byte, path string, opts LoadOptions) ([]*Test, error) {
+	if opts.Format != "" && !isFormat(opts.Format) {
+		return nil, fmt.Errorf("unknown format %q, expected one of %s", opts.Format, strings.Join(Formats(), ", "))
 	}
 
-	return ""
+	l := &loader{file: path, format: opts.Format, strict: opts.Strict, vars: opts.Vars}
+	tests := l.loadTests(data, filepath.Dir(path))
+
+	warn := opts.Warn
+	if warn == nil {
+		warn = func(e *ValidationError) {
+			log.Warn(e)
+		}
+	}
+	for _, w := range sortErrors(l.warnings) {
+		warn(w)
+	}
+
+	if len(l.errs) > 0 {
+		return nil, sortErrors(l.errs)
+	}
+	return tests, nil
+}
+
+// definitions are shared by the tests of a tests file and all files it
+// includes
+type definitions struct {
+	// defaults maps the fields in defaultTestFields and
+	// defaultURLSpecFields to their values
+	defaults   map[string]*yaml.Node
+	urlSpecs   map[string]field
+	components map[string]field
+	execution  object
+	// setup and teardown are the requests of the file and the files it
+	// includes, the ones of included files first
+	setup    []field
+	teardown []field
+}
+
+// fileTest is a test and the directory of the file defining it
+type fileTest struct {
+	test field
+	dir  string
 }
 
-func castInt(sourceValue interface{}) int {
-	switch sourceValue.(type) {
-	case int:
-		return sourceValue.(int)
-	case string:
-		i, err := strconv.Atoi(sourceValue.(string))
-		if err != nil {
-			log.Fatalf(err.Error())
+// loadTests parses all tests in data and the files it includes, feeder
+// files are resolved relative to dir
+func (l *loader) loadTests(data []byte, dir string) []*Test {
+	l.defs = definitions{
+		defaults:   make(map[string]*yaml.Node),
+		urlSpecs:   make(map[string]field),
+		components: make(map[string]field),
+	}
+	root := l.parse(data, l.file)
+	if root == nil {
+		return nil
+	}
+
+	path, err := filepath.Abs(l.file)
+	if err != nil {
+		path = l.file
+	}
+	tests := l.loadDocument(root, dir, map[string]bool{path: true})
+	if len(tests) == 0 {
+		l.errorf(root, "tests", "at least one test is required")
+	}
+
+	l.suiteExtracted = make(map[string]bool)
+	l.suite = &Suite{
+		Setup:     l.loadRequests(l.defs.setup, l.suiteExtracted),
+		Variables: randurl.NewVariables(nil),
+	}
+	l.suite.Teardown = l.loadRequests(l.defs.teardown, copyNames(l.suiteExtracted))
+
+	var (
+		loadedTests []*Test
+		objects     []object
+	)
+	for _, t := range tests {
+		o := l.object(t.test)
+		if lt := l.loadTest(o, t.dir); lt != nil {
+			loadedTests = append(loadedTests, lt)
+			objects = append(objects, o)
+		}
+	}
+	l.loadExecution(loadedTests, objects)
+	l.errs = append(l.errs, duplicateIDs(loadedTests)...)
+	return loadedTests
+}
+
+// duplicateIDs returns an error for every test whose ID is already used by
+// an earlier test
+func duplicateIDs(tests []*Test) ValidationErrors {
+	var errs ValidationErrors
+	first := make(map[string]*Test)
+	for _, t := range tests {
+		f, ok := first[t.ID]
+		if !ok || t.ID == "" {
+			first[t.ID] = t
+			continue
+		}
+		e := *t.origin
+		switch {
+		case f.origin.File == e.File && f.origin.Line == e.Line:
+			e.Reason = fmt.Sprintf("test %s is loaded more than once, is %s included by several files?", t.ID, e.File)
+		case f.origin.Line > 0:
+			e.Reason = fmt.Sprintf("duplicate test ID %s, already used in %s:%d", t.ID, f.origin.File, f.origin.Line)
+		default:
+			e.Reason = fmt.Sprintf("duplicate test ID %s, already used in %s", t.ID, f.origin.File)
+		}
+		errs = append(errs, &e)
+	}
+	return errs
+}
+
+// loadExecution sets DependsOn and Pause of tests according to the
+// execution mode, objects are the mappings the tests were loaded from
+func (l *loader) loadExecution(tests []*Test, objects []object) {
+	e := l.defs.execution
+	mode := l.str(e.get("mode"))
+	pause := l.duration(e.get("pause"))
+	if pause < 0 {
+		l.errorf(e.get("pause").node, e.get("pause").path, "must not be negative")
+	}
+
+	switch mode {
+	case "", "parallel", "sequential":
+		for i, o := range objects {
+			if f := o.get("dependsOn"); f.isSet() {
+				l.errorf(f.node, f.path, "dependsOn requires execution mode dependsOn")
+			}
+			if mode == "sequential" && i > 0 {
+				tests[i].DependsOn = []string{tests[i-1].ID}
+				tests[i].Pause = pause
+			}
+		}
+		if f := e.get("pause"); f.isSet() && mode != "sequential" {
+			l.errorf(f.node, f.path, "pause requires execution mode sequential or dependsOn")
+		}
+	case "dependsOn":
+		ids := make(map[string]bool)
+		for _, t := range tests {
+			ids[t.ID] = true
+		}
+		for i, o := range objects {
+			for _, f := range l.list(o.get("dependsOn")) {
+				id := l.str(f)
+				switch {
+				case id == tests[i].ID:
+					l.errorf(f.node, f.path, "test can't depend on itself")
+				case !ids[id]:
+					l.errorf(f.node, f.path, "unknown test %q", id)
+				default:
+					tests[i].DependsOn = append(tests[i].DependsOn, id)
+				}
+			}
+			if len(tests[i].DependsOn) > 0 {
+				tests[i].Pause = pause
+			}
+		}
+		if cycle := dependencyCycle(tests); cycle != nil {
+			for i, t := range tests {
+				if t.ID == cycle[0] {
+					f := objects[i].get("dependsOn")
+					l.errorf(f.node, f.path, "dependency cycle %s", strings.Join(cycle, " -> "))
+				}
+			}
 		}
-		return i
 	default:
-		log.Fatalln("Uh oh")
+		f := e.get("mode")
+		l.errorf(f.node, f.path, "must be parallel, sequential or dependsOn, got %q", mode)
+	}
+}
+
+// dependencyCycle returns the IDs of tests forming a cycle of dependencies,
+// e.g. a -> b -> a, or nil if there is none
+func dependencyCycle(tests []*Test) []string {
+	byID := make(map[string]*Test)
+	for _, t := range tests {
+		byID[t.ID] = t
 	}
 
-	return 0
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[string]int)
+	var path []string
+	var visit func(t *Test) []string
+	visit = func(t *Test) []string {
+		state[t.ID] = visiting
+		path = append(path, t.ID)
+		for _, id := range t.DependsOn {
+			dep, ok := byID[id]
+			if !ok {
+				continue
+			}
+			switch state[id] {
+			case visiting:
+				for i := range path {
+					if path[i] == id {
+						return append(append([]string{}, path[i:]...), id)
+					}
+				}
+			case 0:
+				if cycle := visit(dep); cycle != nil {
+					return cycle
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		state[t.ID] = visited
+		return nil
+	}
+
+	for _, t := range tests {
+		if state[t.ID] == 0 {
+			if cycle := visit(t); cycle != nil {
+				return cycle
+			}
+		}
+	}
+	return nil
 }
 
-// LoadTestsFromFile parses the specified yaml file and return a slice of *Test
-func LoadTestsFromFile(path string) ([]*Test, error) {
-	// This slice is filled with the final Test objects
-	var loadedTests []*Test
+// parse returns the root node of data read from file with all variables
+// replaced, or nil if the file is invalid or empty
+func (l *loader) parse(data []byte, file string) *yaml.Node {
+	format := formatOf(file)
+	if file == l.file && l.format != "" {
+		format = l.format
+	}
+	root, err := decode(data, format)
+	if err != nil {
+		l.syntaxError(file, err)
+		return nil
+	}
+	if root == nil {
+		l.errs = append(l.errs, &ValidationError{File: file, Reason: "file is empty"})
+		return nil
+	}
+	if file != l.file {
+		l.addFile(root, file)
+	}
+	l.interpolate(root, "")
+	return root
+}
 
-	// data, err := ioutil.ReadFile("components.yaml")
-	data, err := ioutil.ReadFile(path)
+// loadDocument adds the definitions of the document n and the files it
+// includes to l.defs and returns their tests. Definitions of a file take
+// precedence over the ones of the files it includes. includes contains
+// the absolute paths of the files currently being loaded to detect cycles.
+func (l *loader) loadDocument(n *yaml.Node, dir string, includes map[string]bool) []fileTest {
+	doc := l.object(field{node: n})
+	l.checkFields(doc, documentSchema)
+
+	var tests []fileTest
+	for _, f := range l.list(doc.get("include")) {
+		tests = append(tests, l.loadInclude(f, dir, includes)...)
+	}
+	l.defs.setup = append(l.defs.setup, l.list(doc.get("setup"))...)
+	l.defs.teardown = append(l.defs.teardown, l.list(doc.get("teardown"))...)
+
+	defaults := l.object(doc.get("defaults"))
+	l.checkFields(defaults, defaultsSchema)
+	for name := range defaultsSchema.Properties {
+		if f := defaults.get(name); f.isSet() {
+			l.defs.defaults[name] = f.node
+		}
+	}
+
+	specs := l.object(doc.get("urlSpecs"))
+	for name := range specs.values {
+		f := specs.get(name)
+		s := l.object(f)
+		l.checkFields(s, urlSpecSchema)
+		if ref := s.get("ref"); ref.isSet() {
+			l.errorf(ref.node, ref.path, "named urlSpecs can't refer to other urlSpecs")
+		}
+		l.defs.urlSpecs[name] = f
+	}
+
+	if f := doc.get("execution"); f.isSet() {
+		l.defs.execution = l.object(f)
+		l.checkFields(l.defs.execution, executionSchema)
+	}
+
+	components := l.object(doc.get("components"))
+	for name := range components.values {
+		l.defs.components[name] = components.get(name)
+	}
+
+	for _, t := range l.list(doc.get("tests")) {
+		tests = append(tests, fileTest{test: t, dir: dir})
+	}
+	return tests
+}
+
+// loadInclude loads the file referred to by f relative to dir
+func (l *loader) loadInclude(f field, dir string, includes map[string]bool) []fileTest {
+	path := l.str(f)
+	if path == "" {
+		l.errorf(f.node, f.path, "must not be empty")
+		return nil
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	abs, err := filepath.Abs(path)
 	if err != nil {
-		return loadedTests, err
+		abs = path
+	}
+	if includes[abs] {
+		l.errorf(f.node, f.path, "%s includes itself", path)
+		return nil
 	}
 
-	// Load list of testYaml into m
-	m := new(doc)
-	err = yaml.Unmarshal([]byte(data), &m)
+	data, err := ioutil.ReadFile(path)
 	if err != nil {
-		return loadedTests, err
-	}
-
-	// Go thrhough all testYaml structs
-	for _, mt := range m.Tests {
-		// Prepare the proper Test object, whill be added to
-		// loadedtests once all of its members have been populated
-		lt := Test{
-			ID:                      mt.ID,
-			Concurrency:             mt.Concurrency,
-			NumRequests:             mt.NumRequests,
-			TargetRequestsPerSecond: mt.TargetRequestsPerSecond,
-		}
-		// Go through all urlSpecYaml structs in mt
-		for _, urlSpec := range mt.Specs {
-			// Prepare the Proper randurl.URLSpec object, whill will be
-			// stored in lt.Specs
-			spec := randurl.URLSpec{
-				Scheme: urlSpec.Scheme,
-				Host:   urlSpec.Host,
-			}
-
-			// Go through all uriComponents in urlSpecYaml
-			// They are untyped, the logic below determines
-			// the appropriate type by looking at the "type" field
-			// and constructs the correct object
-			for _, c := range urlSpec.Components {
-				t, ok := c["type"]
-				if !ok {
-					continue
-				}
-				switch t {
-				case "string":
-					spec.Components = append(spec.Components, randurl.StringComponent(castString(c["value"])))
-				case "integer":
-					spec.Components = append(spec.Components, randurl.RandomIntegerComponent{
-						Min: castInt(c["min"]),
-						Max: castInt(c["max"]),
-					})
-				case "randomString":
-
-					spec.Components = append(spec.Components, randurl.RandomStringComponent{
-						Chars:  []rune(castString(c["chars"])),
-						Format: castString(c["format"]),
-					})
-
-				case "httpStatus":
-					ns := make([]int, 0)
-					for _, n := range c["ranges"].([]interface{}) {
-						ns = append(ns, castInt(n))
-					}
+		l.errorf(f.node, f.path, "unable to include file: %s", err)
+		return nil
+	}
+	n := l.parse(data, path)
+	if n == nil {
+		return nil
+	}
+
+	includes[abs] = true
+	defer delete(includes, abs)
+	return l.loadDocument(n, filepath.Dir(path), includes)
+}
+
+// applyDefaults sets the fields of o that are not set to their values in
+// the defaults block
+func (l *loader) applyDefaults(o object, fields []string) {
+	for _, name := range fields {
+		if v, ok := l.defs.defaults[name]; ok && !o.get(name).isSet() {
+			o.values[name] = v
+		}
+	}
+}
+
+// resolveURLSpec merges the fields of the named urlSpec s refers to into
+// s, fields set in s take precedence. It returns false if the named
+// urlSpec doesn't exist.
+func (l *loader) resolveURLSpec(s object) (object, bool) {
+	ref := s.get("ref")
+	if !ref.isSet() || s.node == nil {
+		return s, true
+	}
+	name := l.str(ref)
+	def, ok := l.defs.urlSpecs[name]
+	if !ok {
+		l.errorf(ref.node, ref.path, "unknown urlSpec %q", name)
+		return s, false
+	}
+
+	for key, v := range l.object(def).values {
+		if !s.get(key).isSet() {
+			s.values[key] = v
+		}
+	}
+	return s, true
+}
+
+// expandComponents replaces references to named components in items by
+// their definitions. refs contains the names of the components currently
+// being expanded to detect cycles.
+func (l *loader) expandComponents(items []field, refs map[string]bool) []field {
+	var expanded []field
+	for _, f := range items {
+		n := f.node
+		if n != nil && n.Kind == yaml.AliasNode {
+			n = n.Alias
+		}
+		if n == nil || n.Kind != yaml.MappingNode {
+			expanded = append(expanded, f)
+			continue
+		}
+		c := l.object(f)
+		ref := c.get("ref")
+		if !ref.isSet() {
+			expanded = append(expanded, f)
+			continue
+		}
+
+		l.checkFields(c, refSchema)
+		name := l.str(ref)
+		def, ok := l.defs.components[name]
+		if !ok {
+			l.errorf(ref.node, ref.path, "unknown component %q", name)
+			continue
+		}
+		if refs[name] {
+			l.errorf(ref.node, ref.path, "component %s refers to itself", name)
+			continue
+		}
+		if !def.isSet() {
+			continue
+		}
+
+		defItems := []field{def}
+		if d := def.node; d.Kind == yaml.SequenceNode || (d.Kind == yaml.AliasNode && d.Alias.Kind == yaml.SequenceNode) {
+			defItems = l.list(def)
+		}
+		refs[name] = true
+		expanded = append(expanded, l.expandComponents(defItems, refs)...)
+		delete(refs, name)
+	}
+	return expanded
+}
+
+func (l *loader) loadTest(mt object, dir string) *Test {
+	l.checkFields(mt, testSchema)
+	l.applyDefaults(mt, defaultTestFields)
+	lt := Test{
+		ID:                      l.str(mt.get("id")),
+		Tags:                    l.strs(mt.get("tags")),
+		Concurrency:             l.positiveInt(mt.get("concurrency")),
+		TargetRequestsPerSecond: l.int(mt.get("targetRequestsPerSecond")),
+		Duration:                l.duration(mt.get("duration")),
+		Method:                  l.str(mt.get("method")),
+		Body:                    l.str(mt.get("body")),
+		Thresholds:              l.loadThresholds(l.object(mt.get("thresholds"))),
+	}
+
+	if l.required(mt.get("id")) && lt.ID == "" {
+		l.errorf(mt.get("id").node, mt.get("id").path, "must not be empty")
+	}
+	lt.origin = l.locate(mt.get("id").node, mt.get("id").path)
+	lt.Source = lt.origin.File
+	// Without a number of requests the test runs for its duration
+	if f := mt.get("numRequests"); f.isSet() || !mt.get("duration").isSet() {
+		lt.NumRequests = l.positiveInt(f)
+	}
+	if lt.TargetRequestsPerSecond < 0 {
+		f := mt.get("targetRequestsPerSecond")
+		l.errorf(f.node, f.path, "must not be negative")
+	}
+	if f := mt.get("duration"); f.isSet() && lt.Duration <= 0 {
+		l.errorf(f.node, f.path, "must be greater than 0")
+	}
+	if f := mt.get("method"); f.isSet() && !httpToken.MatchString(lt.Method) {
+		l.errorf(f.node, f.path, "invalid HTTP method %q", lt.Method)
+	}
+
+	lt.Header = l.headers(mt.get("headers"))
+
+	// Extracted components can use the values extracted by the setup of
+	// the file and the test
+	extracted := copyNames(l.suiteExtracted)
+	lt.Suite = l.suite
+	lt.Variables = randurl.NewVariables(l.suite.Variables)
+	lt.Setup = l.loadRequests(l.list(mt.get("setup")), extracted)
+	lt.Teardown = l.loadRequests(l.list(mt.get("teardown")), copyNames(extracted))
+	l.variables, l.extracted = lt.Variables, extracted
 
-					spec.Components = append(spec.Components, randurl.RandomHTTPStatusComponent{
-						Ranges: ns,
-					})
+	feeders := make(map[string]*randurl.Feeder)
+	for _, f := range l.list(mt.get("feeders")) {
+		feeder := l.loadFeeder(l.object(f), dir)
+		if feeder == nil {
+			continue
+		}
+		if _, ok := feeders[feeder.Name]; ok {
+			l.errorf(f.node, f.path, "duplicate feeder %s", feeder.Name)
+		}
+		feeders[feeder.Name] = feeder
+	}
 
+	specs := l.list(mt.get("urlSpecs"))
+	if l.required(mt.get("urlSpecs")) && len(specs) == 0 {
+		l.errorf(mt.get("urlSpecs").node, mt.get("urlSpecs").path, "at least one urlSpec is required")
+	}
+	var specObjects []object
+	for _, s := range specs {
+		so, ok := l.resolveURLSpec(l.object(s))
+		if !ok {
+			continue
+		}
+		specObjects = append(specObjects, so)
+		lt.Specs = append(lt.Specs, l.loadURLSpec(so, feeders))
+	}
+
+	// Spec names need to be unique to tell the specs apart in reports,
+	// generated names are made unique by appending their index
+	names := make(map[string]bool)
+	for i := range lt.Specs {
+		name := lt.Specs[i].Name
+		if names[name] {
+			if f := specObjects[i].get("name"); f.isSet() {
+				l.errorf(f.node, f.path, "duplicate urlSpec name %s", name)
+			}
+			lt.Specs[i].Name = fmt.Sprintf("%s#%d", name, i)
+		}
+		names[lt.Specs[i].Name] = true
+	}
+
+	// Either all or none of the specs need to have a weight
+	weighted := 0
+	for _, spec := range lt.Specs {
+		if spec.Weight > 0 {
+			weighted++
+		}
+	}
+	if weighted > 0 && weighted < len(lt.Specs) {
+		l.errorf(mt.get("urlSpecs").node, mt.get("urlSpecs").path, "either all or none of the urlSpecs need a weight")
+	}
+	return &lt
+}
+
+// headers returns the headers in f, nil if there are none
+func (l *loader) headers(f field) http.Header {
+	var header http.Header
+	headers := l.object(f)
+	for name := range headers.values {
+		f := headers.get(name)
+		if !httpToken.MatchString(name) {
+			l.errorf(f.node, f.path, "invalid header name %q", name)
+			continue
+		}
+		if header == nil {
+			header = make(http.Header)
+		}
+		header.Add(name, l.str(f))
+	}
+	return header
+}
+
+// loadRequests builds the setup or teardown requests in fields. extracted
+// contains the names of the variables extracted by earlier requests, the
+// ones extracted by these requests are added to it.
+func (l *loader) loadRequests(fields []field, extracted map[string]bool) []*Request {
+	var reqs []*Request
+	for _, f := range fields {
+		if r := l.loadRequest(l.object(f), extracted); r != nil {
+			reqs = append(reqs, r)
+		}
+	}
+	return reqs
+}
+
+func (l *loader) loadRequest(o object, extracted map[string]bool) *Request {
+	l.checkFields(o, requestSchema)
+	r := &Request{
+		Name:    l.str(o.get("name")),
+		Method:  l.str(o.get("method")),
+		URL:     l.str(o.get("url")),
+		Header:  l.headers(o.get("headers")),
+		Body:    l.str(o.get("body")),
+		Repeat:  l.int(o.get("repeat")),
+		ForEach: l.str(o.get("forEach")),
+	}
+
+	if f := o.get("method"); !f.isSet() {
+		r.Method = http.MethodGet
+	} else if !httpToken.MatchString(r.Method) {
+		l.errorf(f.node, f.path, "invalid HTTP method %q", r.Method)
+	}
+	if f := o.get("url"); l.required(f) {
+		u, err := url.Parse(placeholderPattern.ReplaceAllString(r.URL, "x"))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			l.errorf(f.node, f.path, "invalid URL %q, expected e.g. https://example.com/login", r.URL)
+		}
+	}
+	if f := o.get("repeat"); f.isSet() && r.Repeat < 1 {
+		l.errorf(f.node, f.path, "must be greater than 0")
+	}
+	if f := o.get("forEach"); f.isSet() {
+		if o.get("repeat").isSet() {
+			l.errorf(f.node, f.path, "repeat and forEach can't be combined")
+		}
+		if !extracted[r.ForEach] {
+			l.errorf(f.node, f.path, "unknown variable %s, it needs to be extracted by an earlier request", r.ForEach)
+		}
+	}
+
+	// Placeholders can only refer to values extracted by earlier requests
+	fields := []field{o.get("url"), o.get("body")}
+	headers := l.object(o.get("headers"))
+	for name := range headers.values {
+		fields = append(fields, headers.get(name))
+	}
+	for _, f := range fields {
+		if !f.isSet() {
+			continue
+		}
+		for _, m := range placeholderPattern.FindAllStringSubmatch(l.str(f), -1) {
+			if name := m[1]; name != "index" && name != r.ForEach && !extracted[name] {
+				l.errorf(f.node, f.path, "unknown variable %s, it needs to be extracted by an earlier request", name)
+			}
+		}
+	}
+
+	for _, f := range l.list(o.get("expectStatus")) {
+		status := l.int(f)
+		if status < 100 || status > 599 {
+			l.errorf(f.node, f.path, "invalid status code %d", status)
+		}
+		r.ExpectStatus = append(r.ExpectStatus, status)
+	}
+
+	extract := l.object(o.get("extract"))
+	for name := range extract.values {
+		f := extract.get(name)
+		if !isVariableName(name) {
+			l.errorf(f.node, f.path, "invalid variable name %q", name)
+			continue
+		}
+		e := l.object(f)
+		l.checkFields(e, extractSchema)
+		set := 0
+		for _, key := range []string{"json", "header", "regex"} {
+			if e.get(key).isSet() {
+				set++
+				if l.str(e.get(key)) == "" {
+					l.errorf(e.get(key).node, e.get(key).path, "must not be empty")
 				}
+			}
+		}
+		if set != 1 {
+			l.errorf(f.node, f.path, "exactly one of json, header or regex is required")
+			continue
+		}
+
+		extractor := Extractor{
+			JSON:   l.str(e.get("json")),
+			Header: l.str(e.get("header")),
+		}
+		if rf := e.get("regex"); rf.isSet() {
+			re, err := regexp.Compile(l.str(rf))
+			if err != nil {
+				l.errorf(rf.node, rf.path, "invalid regex: %s", err)
+			}
+			extractor.Regex = re
+		}
+		if r.Extract == nil {
+			r.Extract = make(map[string]Extractor)
+		}
+		r.Extract[name] = extractor
+		extracted[name] = true
+	}
+
+	if r.Name == "" {
+		r.Name = r.Method + " " + r.URL
+	}
+	return r
+}
+
+// copyNames returns a copy of the set of variable names
+func copyNames(names map[string]bool) map[string]bool {
+	c := make(map[string]bool, len(names))
+	for name := range names {
+		c[name] = true
+	}
+	return c
+}
+
+func (l *loader) loadThresholds(th object) Thresholds {
+	l.checkFields(th, thresholdsSchema)
+	var lt Thresholds
+	if f := th.get("maxErrorPercent"); f.isSet() {
+		p := l.float(f)
+		lt.MaxErrorPercent = &p
+	}
+	lt.MinRequestsPerSecond = l.float(th.get("minRequestsPerSecond"))
+
+	percentiles := l.object(th.get("maxPercentiles"))
+	if percentiles.node != nil {
+		for i := 0; i < len(percentiles.node.Content); i += 2 {
+			key := percentiles.node.Content[i]
+			f := percentiles.get(key.Value)
+			p, err := strconv.ParseFloat(key.Value, 64)
+			if err != nil || p <= 0 || p >= 100 {
+				l.errorf(key, f.path, "invalid percentile %s, expected a number between 0 and 100", key.Value)
+				continue
+			}
+			if lt.MaxPercentiles == nil {
+				lt.MaxPercentiles = make(map[float64]time.Duration)
+			}
+			lt.MaxPercentiles[p/100] = l.duration(f)
+		}
+	}
+
+	for _, f := range l.list(th.get("allowedStatusCodes")) {
+		lt.AllowedStatusCodes = append(lt.AllowedStatusCodes, l.int(f))
+	}
+	return lt
+}
+
+func (l *loader) loadURLSpec(s object, feeders map[string]*randurl.Feeder) randurl.URLSpec {
+	l.checkFields(s, urlSpecSchema)
+	l.applyDefaults(s, defaultURLSpecFields)
+	spec := randurl.URLSpec{
+		Name:   l.str(s.get("name")),
+		Scheme: l.str(s.get("scheme")),
+		Host:   l.str(s.get("host")),
+		Weight: l.float(s.get("weight")),
+	}
+	if l.required(s.get("scheme")) && spec.Scheme != "http" && spec.Scheme != "https" {
+		l.errorf(s.get("scheme").node, s.get("scheme").path, "must be http or https, got %q", spec.Scheme)
+	}
+	if l.required(s.get("host")) && spec.Host == "" {
+		l.errorf(s.get("host").node, s.get("host").path, "must not be empty")
+	}
+	if spec.Weight < 0 {
+		l.errorf(s.get("weight").node, s.get("weight").path, "must not be negative, got %g", spec.Weight)
+	}
+
+	// pattern describes the generated URLs, static components are
+	// included verbatim while generated ones are replaced by their type,
+	// e.g. https://example.com/user/{integer}
+	pattern := strings.Builder{}
+	pattern.WriteString(fmt.Sprintf("%s://%s", spec.Scheme, spec.Host))
+
+	// The components are untyped, the logic below determines the
+	// appropriate type by looking at the "type" field and constructs
+	// the correct object
+	for _, f := range l.expandComponents(l.list(s.get("uriComponents")), make(map[string]bool)) {
+		c := l.object(f)
+		t := l.str(c.get("type"))
+		if !l.required(c.get("type")) {
+			continue
+		}
+
+		component := l.loadComponent(t, c, feeders)
+		if component == nil {
+			continue
+		}
+		spec.Components = append(spec.Components, component)
+
+		switch component := component.(type) {
+		case randurl.StringComponent:
+			pattern.WriteString("/" + string(component))
+		case randurl.FeederComponent:
+			pattern.WriteString(fmt.Sprintf("/{%s.%s}", component.Feeder.Name, component.Column))
+		case randurl.VariableComponent:
+			pattern.WriteString(fmt.Sprintf("/{%s}", component.Name))
+		default:
+			pattern.WriteString(fmt.Sprintf("/{%s}", t))
+		}
+	}
 
+	if spec.Name == "" {
+		spec.Name = pattern.String()
+		if ref := s.get("ref"); ref.isSet() {
+			spec.Name = l.str(ref)
+		}
+	}
+	return spec
+}
+
+// httpToken matches valid HTTP methods and header names
+var httpToken = regexp.MustCompile("^[!#$%&'*+.^_`|~0-9A-Za-z-]+$")
+
+// validator is implemented by components that can check their fields
+type validator interface {
+	Validate() error
+}
+
+// loadComponent builds the component of type t from c, it returns nil
+// if c is invalid
+func (l *loader) loadComponent(t string, c object, feeders map[string]*randurl.Feeder) randurl.PathComponent {
+	if _, ok := componentSchemas[t]; ok {
+		l.checkFields(c, componentSchema(t))
+	}
+	errs := len(l.errs)
+	var component randurl.PathComponent
+
+	switch t {
+	case "string":
+		l.required(c.get("value"))
+		component = randurl.StringComponent(l.str(c.get("value")))
+
+	case "integer":
+		l.required(c.get("min"))
+		l.required(c.get("max"))
+		i := randurl.RandomIntegerComponent{
+			Min:          l.int(c.get("min")),
+			Max:          l.int(c.get("max")),
+			Distribution: randurl.Distribution(l.str(c.get("distribution"))),
+			S:            l.float(c.get("s")),
+			V:            l.float(c.get("v")),
+			StdDev:       l.float(c.get("stdDev")),
+			Rate:         l.float(c.get("rate")),
+		}
+		if f := c.get("mean"); f.isSet() {
+			mean := l.float(f)
+			i.Mean = &mean
+		}
+		component = i
+
+	case "randomString":
+		component = l.loadRandomStringComponent(c)
+
+	case "regex":
+		if l.required(c.get("pattern")) {
+			rc, err := randurl.NewRegexComponent(l.str(c.get("pattern")))
+			if err != nil {
+				l.errorf(c.get("pattern").node, c.get("pattern").path, "%s", err)
 			}
-			lt.Specs = append(lt.Specs, spec)
+			component = rc
+		}
+
+	case "choice", "enum":
+		component = l.loadChoiceComponent(c)
+
+	case "feeder":
+		name := l.str(c.get("feeder"))
+		column := l.str(c.get("column"))
+		if !l.required(c.get("feeder")) || !l.required(c.get("column")) {
+			break
+		}
+		feeder, ok := feeders[name]
+		if !ok {
+			l.errorf(c.get("feeder").node, c.get("feeder").path, "unknown feeder %s", name)
+			break
+		}
+		if !feeder.HasColumn(column) {
+			l.errorf(c.get("column").node, c.get("column").path, "feeder %s has no column %s", name, column)
+			break
+		}
+		component = randurl.FeederComponent{
+			Feeder: feeder,
+			Column: column,
+		}
+
+	case "extracted":
+		name := l.str(c.get("name"))
+		if !l.required(c.get("name")) {
+			break
+		}
+		if !l.extracted[name] {
+			l.errorf(c.get("name").node, c.get("name").path, "unknown variable %s, it needs to be extracted by a setup request", name)
+			break
+		}
+		component = randurl.VariableComponent{
+			Name:      name,
+			Variables: l.variables,
+		}
+
+	case "uuid":
+		uc := randurl.UUIDComponent{Version: 4}
+		if f := c.get("version"); f.isSet() {
+			uc.Version = l.int(f)
+		}
+		component = uc
+
+	case "timestamp":
+		component = randurl.TimestampComponent{
+			Format:    l.str(c.get("format")),
+			MinOffset: l.duration(c.get("minOffset")),
+			MaxOffset: l.duration(c.get("maxOffset")),
+		}
+
+	case "sequence":
+		start, step := 0, 1
+		if f := c.get("start"); f.isSet() {
+			start = l.int(f)
+		}
+		if f := c.get("step"); f.isSet() {
+			step = l.int(f)
+		}
+		component = randurl.NewSequenceComponent(int64(start), int64(step))
+
+	case "hex", "base64":
+		l.required(c.get("length"))
+		component = randurl.RandomBytesComponent{
+			Length:   l.int(c.get("length")),
+			Encoding: t,
+		}
+
+	case "httpStatus":
+		var ns []int
+		ranges := l.list(c.get("ranges"))
+		if l.required(c.get("ranges")) && len(ranges) == 0 {
+			l.errorf(c.get("ranges").node, c.get("ranges").path, "at least one range is required")
+		}
+		for _, f := range ranges {
+			n := l.int(f)
+			if n < 100 || n > 599 {
+				l.errorf(f.node, f.path, "invalid status code range %d, expected e.g. 200 or 500", n)
+			}
+			ns = append(ns, n)
+		}
+		component = randurl.RandomHTTPStatusComponent{
+			Ranges: ns,
+		}
+
+	default:
+		f := c.get("type")
+		l.errorf(f.node, f.path, "unknown component type %q, expected one of %s", t, strings.Join(componentTypes(), ", "))
+	}
+
+	if len(l.errs) > errs || component == nil {
+		return nil
+	}
+	if v, ok := component.(validator); ok {
+		if err := v.Validate(); err != nil {
+			l.errorf(c.node, c.path, "%s component: %s", t, err)
+			return nil
+		}
+	}
+	return component
+}
+
+// loadRandomStringComponent builds a RandomStringComponent. If only one of
+// minLength and maxLength is set the other one defaults to the same value.
+func (l *loader) loadRandomStringComponent(c object) randurl.RandomStringComponent {
+	rc := randurl.RandomStringComponent{
+		Chars:  []rune(l.str(c.get("chars"))),
+		Format: l.str(c.get("format")),
+	}
+	if len(rc.Chars) == 0 {
+		rc.Chars = nil
+	}
+
+	min, max := c.get("minLength"), c.get("maxLength")
+	if min.isSet() {
+		rc.MinLength = l.int(min)
+		rc.MaxLength = rc.MinLength
+	}
+	if max.isSet() {
+		rc.MaxLength = l.int(max)
+		if !min.isSet() {
+			rc.MinLength = rc.MaxLength
+		}
+	}
+
+	classes := l.object(c.get("classes"))
+	if classes.node != nil {
+		rc.Classes = make(map[string][]rune, len(classes.values))
+		for name := range classes.values {
+			rc.Classes[name] = []rune(l.str(classes.get(name)))
+		}
+	}
+	return rc
+}
+
+// loadChoiceComponent builds a ChoiceComponent from the values and
+// weights of c. Values can either be a list or a string separated by "|".
+func (l *loader) loadChoiceComponent(c object) randurl.ChoiceComponent {
+	var cc randurl.ChoiceComponent
+	values := c.get("values")
+	if !l.required(values) {
+		return cc
+	}
+	if values.node.Kind == yaml.SequenceNode {
+		for _, f := range l.list(values) {
+			cc.Values = append(cc.Values, l.str(f))
+		}
+	} else {
+		cc.Values = strings.Split(l.str(values), "|")
+	}
+	if len(cc.Values) == 0 {
+		l.errorf(values.node, values.path, "at least one value is required")
+		return cc
+	}
+
+	weights := c.get("weights")
+	if !weights.isSet() {
+		return cc
+	}
+	ws := l.list(weights)
+	if len(ws) != len(cc.Values) {
+		l.errorf(weights.node, weights.path, "%d values but %d weights", len(cc.Values), len(ws))
+		return cc
+	}
+	total := 0.0
+	for _, f := range ws {
+		w := l.float(f)
+		if w < 0 {
+			l.errorf(f.node, f.path, "negative weight %g", w)
+		}
+		total += w
+		cc.Weights = append(cc.Weights, w)
+	}
+	if total == 0 {
+		l.errorf(weights.node, weights.path, "weights must not all be 0")
+	}
+	return cc
+}
+
+// loadFeeder reads the data file of f, relative paths are resolved
+// relative to dir. It returns nil if the Feeder can't be loaded.
+func (l *loader) loadFeeder(f object, dir string) *randurl.Feeder {
+	l.checkFields(f, feederSchema)
+	name := l.str(f.get("name"))
+	path := l.str(f.get("file"))
+	if !l.required(f.get("name")) || !l.required(f.get("file")) {
+		return nil
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+
+	format := l.str(f.get("format"))
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+	}
+	var read func(io.Reader) ([]string, []randurl.Row, error)
+	switch format {
+	case "csv":
+		read = randurl.ReadCSV
+	case "jsonl", "ndjson":
+		read = randurl.ReadJSONL
+	default:
+		l.errorf(f.node, f.path, "unknown format %q, use csv or jsonl", format)
+		return nil
+	}
+
+	mode := randurl.FeederMode(l.str(f.get("mode")))
+	if mode == "" {
+		mode = randurl.SequentialFeeder
+	}
+	var wrap bool
+	onExhausted := f.get("onExhausted")
+	switch v := l.str(onExhausted); v {
+	case "":
+		// Unique rows are usually required because they can't be reused
+		wrap = mode != randurl.UniqueFeeder
+	case "wrap":
+		wrap = true
+	case "stop":
+		wrap = false
+	default:
+		l.errorf(onExhausted.node, onExhausted.path, "must be wrap or stop, got %s", v)
+		return nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		l.errorf(f.get("file").node, f.get("file").path, "%s", err)
+		return nil
+	}
+	defer file.Close()
+	columns, rows, err := read(file)
+	if err != nil {
+		l.errorf(f.get("file").node, f.get("file").path, "%s: %s", path, err)
+		return nil
+	}
+
+	feeder, err := randurl.NewFeeder(name, columns, rows, mode, wrap)
+	if err != nil {
+		l.errorf(f.node, f.path, "%s", err)
+		return nil
+	}
+	return feeder
+}
+
+// sortErrors orders errs by file and their position in the file and
+// removes duplicates, e.g. of named urlSpecs used by several tests
+func sortErrors(errs ValidationErrors) ValidationErrors {
+	sort.SliceStable(errs, func(i, j int) bool {
+		if errs[i].File != errs[j].File {
+			return errs[i].File < errs[j].File
+		}
+		if errs[i].Line != errs[j].Line {
+			return errs[i].Line < errs[j].Line
+		}
+		if errs[i].Column != errs[j].Column {
+			return errs[i].Column < errs[j].Column
+		}
+		if errs[i].Path != errs[j].Path {
+			return errs[i].Path < errs[j].Path
+		}
+		return errs[i].Reason < errs[j].Reason
+	})
+
+	var unique ValidationErrors
+	for i, e := range errs {
+		if i > 0 && *e == *errs[i-1] {
+			continue
 		}
-		loadedTests = append(loadedTests, &lt)
+		unique = append(unique, e)
 	}
-	return loadedTests, nil
+	return unique
 }
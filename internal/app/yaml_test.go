@@ -3,8 +3,11 @@ package app
 import (
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"reflect"
+	"sort"
 	"testing"
+	"time"
 
 	"github.com/pbaettig/request0r/pkg/randurl"
 )
@@ -116,3 +119,1122 @@ tests:
 	}
 
 }
+
+// writeTempFile writes text to a temporary file and returns its name
+func writeTempFile(t *testing.T, text string) string {
+	tmpFile, err := ioutil.TempFile(os.TempDir(), "prefix-")
+	if err != nil {
+		t.Fatalf("Cannot create temporary file: %s", err)
+	}
+	defer tmpFile.Close()
+	if _, err = tmpFile.WriteString(text); err != nil {
+		t.Fatalf("Failed to write to temporary file: %s", err)
+	}
+	return tmpFile.Name()
+}
+
+// writeComponentFile writes a valid tests file containing a single
+// uriComponent and returns its name
+func writeComponentFile(t *testing.T, component string) string {
+	return writeTempFile(t, `
+tests:
+- id: unit-test
+  numRequests: 1
+  concurrency: 1
+  urlSpecs:
+  - scheme: https
+    host: test-host.tester.local
+    uriComponents:
+    - `+component)
+}
+
+func TestLoadTestsFromFile_Thresholds(t *testing.T) {
+	tmpFile := writeTempFile(t, `
+tests:
+- id: unit-test
+  numRequests: 10
+  concurrency: 10
+  thresholds:
+    maxErrorPercent: 0.5
+    minRequestsPerSecond: 100
+    maxPercentiles:
+      99: 500ms
+      50: 20ms
+    allowedStatusCodes:
+    - 200
+    - 404
+  urlSpecs:
+  - scheme: https
+    host: test-host.tester.local
+`)
+	defer os.Remove(tmpFile)
+
+	maxErrorPercent := 0.5
+	correct := Thresholds{
+		MaxErrorPercent:      &maxErrorPercent,
+		MinRequestsPerSecond: 100,
+		MaxPercentiles: map[float64]time.Duration{
+			0.99: 500 * time.Millisecond,
+			0.5:  20 * time.Millisecond,
+		},
+		AllowedStatusCodes: []int{200, 404},
+	}
+
+	loadedTests, err := LoadTestsFromFile(tmpFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded := loadedTests[0].Thresholds; !reflect.DeepEqual(loaded, correct) {
+		t.Errorf("Loaded thresholds are incorrect, wanted %+v, got %+v", correct, loaded)
+	}
+}
+
+func TestLoadTestsFromFile_ThresholdsInvalid(t *testing.T) {
+	testTable := []string{
+		`maxPercentiles: {100: 1s}`,
+		`maxPercentiles: {p99: 1s}`,
+		`maxPercentiles: {99: fast}`,
+		`maxErrorPercent: many`,
+		`allowedStatusCodes: [ok]`,
+	}
+
+	for _, thresholds := range testTable {
+		tmpFile := writeTempFile(t, `
+tests:
+- id: unit-test
+  numRequests: 10
+  concurrency: 10
+  thresholds: {`+thresholds+`}
+  urlSpecs:
+  - scheme: https
+    host: test-host.tester.local
+`)
+		defer os.Remove(tmpFile)
+
+		if _, err := LoadTestsFromFile(tmpFile); err == nil {
+			t.Errorf("Expected an error loading thresholds %s", thresholds)
+		}
+	}
+}
+
+func TestLoadTestsFromFile_Choice(t *testing.T) {
+	tmpFile := writeTempFile(t, `
+tests:
+- id: unit-test
+  numRequests: 10
+  concurrency: 10
+  urlSpecs:
+  - scheme: https
+    host: test-host.tester.local
+    uriComponents:
+    - type: choice
+      values: en|de|fr
+    - type: enum
+      values:
+      - books
+      - music
+      weights:
+      - 3
+      - 0.5
+`)
+	defer os.Remove(tmpFile)
+
+	correct := []randurl.PathComponent{
+		randurl.ChoiceComponent{Values: []string{"en", "de", "fr"}},
+		randurl.ChoiceComponent{Values: []string{"books", "music"}, Weights: []float64{3, 0.5}},
+	}
+
+	loadedTests, err := LoadTestsFromFile(tmpFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded := loadedTests[0].Specs[0].Components; !reflect.DeepEqual(loaded, correct) {
+		t.Errorf("Loaded uriComponents are incorrect, wanted %+v, got %+v", correct, loaded)
+	}
+}
+
+func TestLoadTestsFromFile_ChoiceInvalid(t *testing.T) {
+	testTable := []string{
+		`{type: choice, values: []}`,
+		`{type: choice, values: a|b, weights: [1]}`,
+		`{type: choice, values: a|b, weights: [1, -1]}`,
+		`{type: choice, values: a|b, weights: [0, 0]}`,
+	}
+
+	for _, component := range testTable {
+		tmpFile := writeComponentFile(t, component)
+		defer os.Remove(tmpFile)
+
+		if _, err := LoadTestsFromFile(tmpFile); err == nil {
+			t.Errorf("Expected an error loading choice component with %s", component)
+		}
+	}
+}
+
+func TestLoadTestsFromFile_RandomString(t *testing.T) {
+	tmpFile := writeTempFile(t, `
+tests:
+- id: unit-test
+  numRequests: 1
+  concurrency: 1
+  urlSpecs:
+  - scheme: https
+    host: test-host.tester.local
+    uriComponents:
+    - type: randomString
+      chars: "4567"
+      minLength: 2
+      maxLength: 5
+      format: "%sms"
+    - type: randomString
+      format: "%{digits}4,4s-%{vowels}2,2s"
+      classes:
+        vowels: aeiou
+    - {type: randomString, chars: abc, maxLength: 3}
+`)
+	defer os.Remove(tmpFile)
+
+	correct := []randurl.PathComponent{
+		randurl.RandomStringComponent{Chars: []rune("4567"), Format: "%sms", MinLength: 2, MaxLength: 5},
+		randurl.RandomStringComponent{Format: "%{digits}4,4s-%{vowels}2,2s", Classes: map[string][]rune{"vowels": []rune("aeiou")}},
+		randurl.RandomStringComponent{Chars: []rune("abc"), MinLength: 3, MaxLength: 3},
+	}
+
+	loadedTests, err := LoadTestsFromFile(tmpFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded := loadedTests[0].Specs[0].Components; !reflect.DeepEqual(loaded, correct) {
+		t.Errorf("Loaded uriComponents are incorrect, wanted %+v, got %+v", correct, loaded)
+	}
+
+	invalid := []string{
+		`{type: randomString, chars: abc}`,
+		`{type: randomString, format: "%{unknown}2,2s"}`,
+		`{type: randomString, chars: abc, minLength: 5, maxLength: 2}`,
+		`{type: randomString, chars: abc, format: "%1,2s", minLength: 2}`,
+		`{type: randomString, format: "%{x}s", maxLength: 2, classes: [x]}`,
+	}
+	for _, component := range invalid {
+		tmpFile := writeComponentFile(t, component)
+		defer os.Remove(tmpFile)
+
+		if _, err := LoadTestsFromFile(tmpFile); err == nil {
+			t.Errorf("Expected an error loading %s", component)
+		}
+	}
+}
+
+func TestLoadTestsFromFile_Generators(t *testing.T) {
+	tmpFile := writeTempFile(t, `
+tests:
+- id: unit-test
+  numRequests: 1
+  concurrency: 1
+  urlSpecs:
+  - scheme: https
+    host: test-host.tester.local
+    uriComponents:
+    - type: uuid
+    - {type: uuid, version: 7}
+    - {type: timestamp, format: date, minOffset: -24h, maxOffset: 1h}
+    - {type: sequence, start: 100, step: 10}
+    - {type: hex, length: 8}
+    - {type: base64, length: 12}
+    - {type: regex, pattern: "[A-Z]{2}-\\d{6}"}
+`)
+	defer os.Remove(tmpFile)
+
+	regexComponent, err := randurl.NewRegexComponent(`[A-Z]{2}-\d{6}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	correct := []randurl.PathComponent{
+		randurl.UUIDComponent{Version: 4},
+		randurl.UUIDComponent{Version: 7},
+		randurl.TimestampComponent{Format: "date", MinOffset: -24 * time.Hour, MaxOffset: time.Hour},
+		randurl.NewSequenceComponent(100, 10),
+		randurl.RandomBytesComponent{Length: 8, Encoding: "hex"},
+		randurl.RandomBytesComponent{Length: 12, Encoding: "base64"},
+		regexComponent,
+	}
+
+	loadedTests, err := LoadTestsFromFile(tmpFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded := loadedTests[0].Specs[0].Components; !reflect.DeepEqual(loaded, correct) {
+		t.Errorf("Loaded uriComponents are incorrect, wanted %+v, got %+v", correct, loaded)
+	}
+
+	invalid := []string{
+		`{type: uuid, version: 1}`,
+		`{type: timestamp, minOffset: 1h}`,
+		`{type: timestamp, maxOffset: 1d}`,
+		`{type: hex, length: 0}`,
+		`{type: regex, pattern: "(a"}`,
+	}
+	for _, component := range invalid {
+		tmpFile := writeComponentFile(t, component)
+		defer os.Remove(tmpFile)
+
+		if _, err := LoadTestsFromFile(tmpFile); err == nil {
+			t.Errorf("Expected an error loading %s", component)
+		}
+	}
+}
+
+func TestLoadTestsFromFile_NormalMean(t *testing.T) {
+	tmpFile := writeTempFile(t, `
+tests:
+- id: unit-test
+  numRequests: 1
+  concurrency: 1
+  urlSpecs:
+  - scheme: https
+    host: test-host.tester.local
+    uriComponents:
+    - {type: integer, min: -10, max: 100, distribution: normal, mean: 0}
+    - {type: integer, min: -10, max: 100, distribution: normal}
+`)
+	defer os.Remove(tmpFile)
+
+	mean := 0.0
+	correct := []randurl.PathComponent{
+		randurl.RandomIntegerComponent{Min: -10, Max: 100, Distribution: randurl.NormalDistribution, Mean: &mean},
+		randurl.RandomIntegerComponent{Min: -10, Max: 100, Distribution: randurl.NormalDistribution},
+	}
+
+	loadedTests, err := LoadTestsFromFile(tmpFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded := loadedTests[0].Specs[0].Components; !reflect.DeepEqual(loaded, correct) {
+		t.Errorf("Loaded uriComponents are incorrect, wanted %+v, got %+v", correct, loaded)
+	}
+}
+
+func TestLoadTestsFromFile_Weights(t *testing.T) {
+	tmpFile := writeTempFile(t, `
+tests:
+- id: mix
+  numRequests: 100
+  concurrency: 1
+  urlSpecs:
+  - scheme: https
+    host: shop.local
+    weight: 70
+  - scheme: https
+    host: shop.local
+    weight: 30
+- id: partial
+  numRequests: 100
+  concurrency: 1
+  urlSpecs:
+  - scheme: https
+    host: shop.local
+    weight: 70
+  - scheme: https
+    host: shop.local
+`)
+	defer os.Remove(tmpFile)
+
+	if _, err := LoadTestsFromFile(tmpFile); err == nil {
+		t.Error("Expected an error if only some urlSpecs have a weight")
+	}
+
+	tmpFile = writeTempFile(t, `
+tests:
+- id: mix
+  numRequests: 100
+  concurrency: 1
+  urlSpecs:
+  - scheme: https
+    host: shop.local
+    weight: 70
+  - scheme: https
+    host: shop.local
+    weight: 30
+`)
+	defer os.Remove(tmpFile)
+
+	loadedTests, err := LoadTestsFromFile(tmpFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := loadedTests[0].Specs[1].Weight; w != 30 {
+		t.Errorf("Loaded weight is incorrect, wanted 30, got %g", w)
+	}
+}
+
+func TestLoadTestsFromFile_SpecNames(t *testing.T) {
+	tmpFile := writeTempFile(t, `
+tests:
+- id: names
+  numRequests: 1
+  concurrency: 1
+  urlSpecs:
+  - name: item-details
+    scheme: https
+    host: shop.local
+  - scheme: https
+    host: shop.local
+    uriComponents:
+    - type: string
+      value: item
+    - type: integer
+      min: 1
+      max: 10
+  - scheme: https
+    host: shop.local
+    uriComponents:
+    - type: string
+      value: item
+    - type: integer
+      min: 10
+      max: 20
+`)
+	defer os.Remove(tmpFile)
+
+	loadedTests, err := LoadTestsFromFile(tmpFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	correct := []string{"item-details", "https://shop.local/item/{integer}", "https://shop.local/item/{integer}#2"}
+	for i, spec := range loadedTests[0].Specs {
+		if spec.Name != correct[i] {
+			t.Errorf("Name of urlSpec %d is incorrect, wanted %s, got %s", i, correct[i], spec.Name)
+		}
+	}
+
+	tmpFile = writeTempFile(t, `
+tests:
+- id: duplicate
+  numRequests: 1
+  concurrency: 1
+  urlSpecs:
+  - name: item
+    scheme: https
+    host: shop.local
+  - name: item
+    scheme: https
+    host: shop.local
+`)
+	defer os.Remove(tmpFile)
+
+	if _, err := LoadTestsFromFile(tmpFile); err == nil {
+		t.Error("Expected an error for duplicate urlSpec names")
+	}
+}
+
+func TestLoadTestsFromFile_Feeders(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "feeders-")
+	if err != nil {
+		t.Fatalf("Cannot create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "users.csv"), []byte("id,name\n1,alice\n2,bob\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	testsFile := filepath.Join(dir, "tests.yaml")
+	if err := ioutil.WriteFile(testsFile, []byte(`
+tests:
+- id: feeders
+  numRequests: 1
+  concurrency: 1
+  feeders:
+  - name: users
+    file: users.csv
+    mode: unique
+  urlSpecs:
+  - scheme: https
+    host: users.local
+    uriComponents:
+    - type: feeder
+      feeder: users
+      column: id
+    - type: feeder
+      feeder: users
+      column: name
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	loadedTests, err := LoadTestsFromFile(testsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec := loadedTests[0].Specs[0]
+	if spec.Name != "https://users.local/{users.id}/{users.name}" {
+		t.Errorf("Wrong urlSpec name %s", spec.Name)
+	}
+	feeder := spec.Components[0].(randurl.FeederComponent).Feeder
+	if feeder.Mode != randurl.UniqueFeeder || feeder.Wrap || feeder.Len() != 2 {
+		t.Errorf("Feeder loaded incorrectly: %+v", feeder)
+	}
+
+	var generated []string
+	for i := 0; i < 2; i++ {
+		actual, err := spec.Generate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		generated = append(generated, actual)
+	}
+	sort.Strings(generated)
+	if correct := []string{"https://users.local/1/alice", "https://users.local/2/bob"}; !reflect.DeepEqual(generated, correct) {
+		t.Errorf("Generated URLs %v, wanted %v", generated, correct)
+	}
+
+	if err := ioutil.WriteFile(testsFile, []byte(`
+tests:
+- id: feeders
+  numRequests: 1
+  concurrency: 1
+  feeders:
+  - name: users
+    file: users.csv
+  urlSpecs:
+  - scheme: https
+    host: users.local
+    uriComponents:
+    - type: feeder
+      feeder: users
+      column: email
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadTestsFromFile(testsFile); err == nil {
+		t.Error("Expected an error for an unknown feeder column")
+	}
+}
+
+func TestLoadTestsFromFile_ValidationErrors(t *testing.T) {
+	tmpFile := writeTempFile(t, `tests:
+- id: broken
+  numRequests: lots
+  concurrency: 0
+  urlSpecs:
+  - scheme: ftp
+    host: shop.local
+    uriComponents:
+    - type: integer
+      min: 10
+    - type: nope
+    - type: string
+      value: [a, b]
+    - type: httpStatus
+      ranges: [200, 42]
+- numRequests: 1
+  concurrency: 1
+  urlSpecs: []
+`)
+	defer os.Remove(tmpFile)
+
+	_, err := LoadTestsFromFile(tmpFile)
+	errs, ok := err.(ValidationErrors)
+	if !ok {
+		t.Fatalf("Expected ValidationErrors, got %T: %v", err, err)
+	}
+
+	correct := []ValidationError{
+		{Line: 3, Column: 16, Path: "tests[0].numRequests"},
+		{Line: 4, Column: 16, Path: "tests[0].concurrency"},
+		{Line: 6, Column: 13, Path: "tests[0].urlSpecs[0].scheme"},
+		{Line: 9, Column: 7, Path: "tests[0].urlSpecs[0].uriComponents[0].max"},
+		{Line: 11, Column: 13, Path: "tests[0].urlSpecs[0].uriComponents[1].type"},
+		{Line: 13, Column: 14, Path: "tests[0].urlSpecs[0].uriComponents[2].value"},
+		{Line: 15, Column: 21, Path: "tests[0].urlSpecs[0].uriComponents[3].ranges[1]"},
+		{Line: 16, Column: 3, Path: "tests[1].id"},
+		{Line: 18, Column: 13, Path: "tests[1].urlSpecs"},
+	}
+	if len(errs) != len(correct) {
+		t.Fatalf("Expected %d errors, got %d:\n%s", len(correct), len(errs), errs)
+	}
+	for i, e := range errs {
+		c := correct[i]
+		if e.File != tmpFile || e.Line != c.Line || e.Column != c.Column || e.Path != c.Path || e.Reason == "" {
+			t.Errorf("Error %d is incorrect, wanted %d:%d %s, got %s", i, c.Line, c.Column, c.Path, e)
+		}
+	}
+
+	tmpFile = writeTempFile(t, "tests:\n- id: a\n  numRequests: [\n")
+	defer os.Remove(tmpFile)
+	_, err = LoadTestsFromFile(tmpFile)
+	if errs, ok := err.(ValidationErrors); !ok || len(errs) != 1 || errs[0].Line == 0 {
+		t.Errorf("Expected a syntax error with a line number, got %v", err)
+	}
+}
+
+func TestLoadTests_UnknownFields(t *testing.T) {
+	tmpFile := writeTempFile(t, `tests:
+- id: typo
+  numRequests: 1
+  concurrency: 1
+  concurency: 2
+  urlSpecs:
+  - scheme: https
+    host: shop.local
+    uriComponents:
+    - type: integer
+      min: 1
+      max: 10
+      maxx: 20
+`)
+	defer os.Remove(tmpFile)
+
+	var warnings []*ValidationError
+	tests, err := LoadTests(tmpFile, LoadOptions{Warn: func(e *ValidationError) {
+		warnings = append(warnings, e)
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tests) != 1 || tests[0].Concurrency != 1 {
+		t.Errorf("Tests loaded incorrectly: %+v", tests)
+	}
+	if len(warnings) != 2 {
+		t.Fatalf("Expected 2 warnings, got %v", warnings)
+	}
+
+	_, err = LoadTests(tmpFile, LoadOptions{Strict: true, Warn: func(e *ValidationError) {
+		t.Errorf("Unexpected warning %s", e)
+	}})
+	errs, ok := err.(ValidationErrors)
+	if !ok || len(errs) != 2 {
+		t.Fatalf("Expected 2 validation errors, got %v", err)
+	}
+	correct := []ValidationError{
+		{Line: 5, Column: 3, Path: "tests[0].concurency", Reason: "unknown field, did you mean concurrency?"},
+		{Line: 13, Column: 7, Path: "tests[0].urlSpecs[0].uriComponents[0].maxx", Reason: "unknown field, did you mean max?"},
+	}
+	for i, e := range errs {
+		c := correct[i]
+		if e.Line != c.Line || e.Column != c.Column || e.Path != c.Path || e.Reason != c.Reason {
+			t.Errorf("Error %d is incorrect, wanted %d:%d %s: %s, got %s", i, c.Line, c.Column, c.Path, c.Reason, e)
+		}
+	}
+}
+
+func TestLoadTests_Variables(t *testing.T) {
+	tmpFile := writeTempFile(t, `tests:
+- id: vars-${RQ0R_TEST_ENV}
+  numRequests: ${REQUESTS}
+  concurrency: ${CONCURRENCY:-4}
+  urlSpecs:
+  - scheme: https
+    host: ${HOST}
+    uriComponents:
+    - type: string
+      value: token=${TOKEN:-none}/$${literal}
+    - type: regex
+      pattern: ^[a-z]+$
+`)
+	defer os.Remove(tmpFile)
+
+	os.Setenv("RQ0R_TEST_ENV", "staging")
+	os.Setenv("REQUESTS", "10")
+	defer os.Unsetenv("RQ0R_TEST_ENV")
+	defer os.Unsetenv("REQUESTS")
+
+	tests, err := LoadTests(tmpFile, LoadOptions{Vars: map[string]string{
+		"HOST":     "staging.shop.local",
+		"REQUESTS": "20",
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	test := tests[0]
+	if test.ID != "vars-staging" || test.NumRequests != 20 || test.Concurrency != 4 {
+		t.Errorf("Variables substituted incorrectly: %+v", test)
+	}
+	if test.Specs[0].Host != "staging.shop.local" {
+		t.Errorf("Expected host staging.shop.local, got %s", test.Specs[0].Host)
+	}
+	if v := test.Specs[0].Components[0].String(); v != "token=none/${literal}" {
+		t.Errorf("Expected token=none/${literal}, got %s", v)
+	}
+
+	_, err = LoadTests(tmpFile, LoadOptions{})
+	errs, ok := err.(ValidationErrors)
+	if !ok || len(errs) != 1 {
+		t.Fatalf("Expected 1 validation error, got %v", err)
+	}
+	if e := errs[0]; e.Line != 7 || e.Path != "tests[0].urlSpecs[0].host" || e.Reason != "undefined variable HOST" {
+		t.Errorf("Incorrect error for undefined variable: %s", e)
+	}
+}
+
+func TestExpand(t *testing.T) {
+	vars := map[string]string{"A": "a", "EMPTY": ""}
+	valid := map[string]string{
+		"${A}":          "a",
+		"x${A}y${A}":    "xaya",
+		"${EMPTY:-b}":   "b",
+		"${UNSET:-b c}": "b c",
+		"${UNSET:-}":    "",
+		"$${A}":         "${A}",
+		"$A and ${A}$":  "$A and a$",
+		"${A:-default}": "a",
+	}
+	for s, correct := range valid {
+		v, err := expand(s, vars)
+		if err != nil || v != correct {
+			t.Errorf("expand(%q) = %q, %v, wanted %q", s, v, err, correct)
+		}
+	}
+
+	for _, s := range []string{"${UNSET}", "${A", "${}", "${1A}", "${A B}"} {
+		if v, err := expand(s, vars); err == nil {
+			t.Errorf("expand(%q) should have failed, got %q", s, v)
+		}
+	}
+}
+
+func TestLoadTests_Includes(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "includes-")
+	if err != nil {
+		t.Fatalf("Cannot create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"shared/common.yaml": `
+defaults:
+  numRequests: 5
+  concurrency: 2
+  scheme: https
+  host: shop.local
+urlSpecs:
+  product:
+    uriComponents:
+    - type: string
+      value: product
+    - ref: productID
+components:
+  productID:
+    type: integer
+    min: 1
+    max: 100
+  search:
+  - type: string
+    value: search
+  - type: choice
+    values: shoes|shirts
+tests:
+- id: shared
+  urlSpecs:
+  - ref: product
+`,
+		"tests.yaml": `
+include:
+- shared/common.yaml
+defaults:
+  concurrency: 4
+tests:
+- id: main
+  numRequests: 10
+  urlSpecs:
+  - ref: product
+    host: other.local
+  - ref: product
+  - name: search
+    uriComponents:
+    - ref: search
+    - type: string
+      value: all
+`,
+	}
+	for name, text := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests, err := LoadTestsFromFile(filepath.Join(dir, "tests.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tests) != 2 {
+		t.Fatalf("Expected 2 tests, got %d", len(tests))
+	}
+
+	shared, main := tests[0], tests[1]
+	if shared.ID != "shared" || shared.NumRequests != 5 || shared.Concurrency != 4 {
+		t.Errorf("Defaults applied incorrectly: %+v", shared)
+	}
+	if main.ID != "main" || main.NumRequests != 10 || main.Concurrency != 4 {
+		t.Errorf("Defaults applied incorrectly: %+v", main)
+	}
+
+	spec := shared.Specs[0]
+	if spec.Name != "product" || spec.Scheme != "https" || spec.Host != "shop.local" || len(spec.Components) != 2 {
+		t.Errorf("Named urlSpec resolved incorrectly: %+v", spec)
+	}
+	if _, ok := spec.Components[1].(randurl.RandomIntegerComponent); !ok {
+		t.Errorf("Expected an integer component, got %T", spec.Components[1])
+	}
+	if spec := main.Specs[0]; spec.Name != "product" || spec.Host != "other.local" {
+		t.Errorf("Fields of the named urlSpec should be overridden: %+v", spec)
+	}
+	if spec := main.Specs[1]; spec.Name != "product#1" {
+		t.Errorf("Expected a unique name for the second product urlSpec, got %s", spec.Name)
+	}
+	if spec := main.Specs[2]; len(spec.Components) != 3 || spec.Components[0].String() != "search" || spec.Components[2].String() != "all" {
+		t.Errorf("Component list expanded incorrectly: %+v", spec)
+	}
+}
+
+func TestLoadTests_IncludeErrors(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "includes-")
+	if err != nil {
+		t.Fatalf("Cannot create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	testsFile := filepath.Join(dir, "tests.yaml")
+	otherFile := filepath.Join(dir, "other.yaml")
+	if err := ioutil.WriteFile(testsFile, []byte(`include:
+- other.yaml
+- missing.yaml
+tests:
+- id: broken
+  numRequests: 1
+  concurrency: 1
+  urlSpecs:
+  - ref: unknown
+  - scheme: http
+    host: a.local
+    uriComponents:
+    - ref: loop
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(otherFile, []byte(`include:
+- tests.yaml
+components:
+  loop:
+    ref: loop
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = LoadTestsFromFile(testsFile)
+	errs, ok := err.(ValidationErrors)
+	if !ok || len(errs) != 4 {
+		t.Fatalf("Expected 4 validation errors, got %v", err)
+	}
+	correct := []ValidationError{
+		{File: otherFile, Line: 2, Column: 3, Path: "include[0]", Reason: testsFile + " includes itself"},
+		{File: otherFile, Line: 5, Column: 10, Path: "components.loop.ref", Reason: "component loop refers to itself"},
+		{File: testsFile, Line: 3, Column: 3, Path: "include[1]"},
+		{File: testsFile, Line: 9, Column: 10, Path: "tests[0].urlSpecs[0].ref", Reason: `unknown urlSpec "unknown"`},
+	}
+	for i, e := range errs {
+		c := correct[i]
+		if e.File != c.File || e.Line != c.Line || e.Column != c.Column || e.Path != c.Path || (c.Reason != "" && e.Reason != c.Reason) {
+			t.Errorf("Error %d is incorrect, wanted %s, got %s", i, &c, e)
+		}
+	}
+}
+
+func TestLoadTestsFromFile_Requests(t *testing.T) {
+	tmpFile := writeTempFile(t, `tests:
+- id: requests
+  duration: 30s
+  concurrency: 1
+  method: POST
+  headers:
+    Content-Type: application/json
+  body: '{"id": 1}'
+  urlSpecs:
+  - scheme: https
+    host: shop.local
+`)
+	defer os.Remove(tmpFile)
+
+	tests, err := LoadTestsFromFile(tmpFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	test := tests[0]
+	if test.NumRequests != 0 || test.Duration != 30*time.Second || !test.IsUnlimited() {
+		t.Errorf("Expected an unlimited test running for 30s, got %+v", test)
+	}
+	if test.Method != "POST" || test.Header.Get("Content-Type") != "application/json" || test.Body != `{"id": 1}` {
+		t.Errorf("Request fields loaded incorrectly: %+v", test)
+	}
+
+	for _, invalid := range []string{"method: GET POST", "headers: {'X Token': a}", "duration: 0s", "numRequests: 0\n  duration: 1s"} {
+		tmpFile := writeTempFile(t, `tests:
+- id: requests
+  concurrency: 1
+  `+invalid+`
+  urlSpecs:
+  - scheme: https
+    host: shop.local
+`)
+		defer os.Remove(tmpFile)
+		if _, err := LoadTestsFromFile(tmpFile); err == nil {
+			t.Errorf("Expected an error for %s", invalid)
+		}
+	}
+}
+
+func TestLoadTests_Execution(t *testing.T) {
+	load := func(execution, dependsOn string) ([]*Test, error) {
+		tmpFile := writeTempFile(t, execution+`
+defaults:
+  numRequests: 1
+  concurrency: 1
+  scheme: https
+  host: shop.local
+tests:
+- id: warmup
+  tags: [setup]
+  urlSpecs: [{}]
+- id: measure
+  `+dependsOn+`
+  urlSpecs: [{}]
+- id: report
+  urlSpecs: [{}]
+`)
+		defer os.Remove(tmpFile)
+		return LoadTestsFromFile(tmpFile)
+	}
+
+	tests, err := load("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range tests {
+		if len(test.DependsOn) != 0 {
+			t.Errorf("Tests should run in parallel by default, %s depends on %v", test.ID, test.DependsOn)
+		}
+	}
+	if !reflect.DeepEqual(tests[0].Tags, []string{"setup"}) {
+		t.Errorf("Expected tags [setup], got %v", tests[0].Tags)
+	}
+
+	tests, err = load("execution: {mode: sequential, pause: 10s}", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tests[0].DependsOn) != 0 || tests[1].DependsOn[0] != "warmup" || tests[2].DependsOn[0] != "measure" || tests[2].Pause != 10*time.Second {
+		t.Errorf("Sequential tests should depend on the previous one: %v, %v, %v", tests[0].DependsOn, tests[1].DependsOn, tests[2].DependsOn)
+	}
+
+	tests, err = load("execution: {mode: dependsOn, pause: 1s}", "dependsOn: [warmup]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tests[0].DependsOn) != 0 || !reflect.DeepEqual(tests[1].DependsOn, []string{"warmup"}) || tests[1].Pause != time.Second || tests[2].Pause != 0 {
+		t.Errorf("Dependencies loaded incorrectly: %+v", tests)
+	}
+
+	invalid := map[string][2]string{
+		"dependsOn in parallel mode": {"", "dependsOn: [warmup]"},
+		"pause in parallel mode":     {"execution: {pause: 1s}", ""},
+		"unknown mode":               {"execution: {mode: random}", ""},
+		"unknown test":               {"execution: {mode: dependsOn}", "dependsOn: [unknown]"},
+		"self dependency":            {"execution: {mode: dependsOn}", "dependsOn: [measure]"},
+	}
+	for name, c := range invalid {
+		if _, err := load(c[0], c[1]); err == nil {
+			t.Errorf("Expected an error for %s", name)
+		}
+	}
+
+	tmpFile := writeTempFile(t, `execution:
+  mode: dependsOn
+defaults: {numRequests: 1, concurrency: 1, scheme: https, host: shop.local}
+tests:
+- id: a
+  dependsOn: [c]
+  urlSpecs: [{}]
+- id: b
+  dependsOn: [a]
+  urlSpecs: [{}]
+- id: c
+  dependsOn: [b]
+  urlSpecs: [{}]
+`)
+	defer os.Remove(tmpFile)
+	_, err = LoadTestsFromFile(tmpFile)
+	if errs, ok := err.(ValidationErrors); !ok || len(errs) != 1 || errs[0].Reason != "dependency cycle a -> c -> b -> a" || errs[0].Line != 6 {
+		t.Errorf("Expected a dependency cycle error, got %v", err)
+	}
+}
+
+func TestLoadTests_Setup(t *testing.T) {
+	load := func(setup, components string) ([]*Test, error) {
+		tmpFile := writeTempFile(t, `setup:
+- url: https://shop.local/login
+  method: POST
+  extract:
+    token: {json: token}
+defaults: {numRequests: 1, concurrency: 1, scheme: https, host: shop.local}
+tests:
+- id: orders
+  setup:
+  `+setup+`
+  teardown:
+  - url: https://shop.local/users/{{userID}}
+    method: DELETE
+  urlSpecs:
+  - uriComponents:
+    - type: string
+      value: users
+    `+components+`
+`)
+		defer os.Remove(tmpFile)
+		return LoadTestsFromFile(tmpFile)
+	}
+
+	tests, err := load(`- url: https://shop.local/users?token={{token}}
+    headers: {Authorization: "Bearer {{token}}"}
+    extract:
+      userID: {json: "users.*.id"}`, `- type: extracted
+      name: userID`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	test := tests[0]
+	if len(test.Suite.Setup) != 1 || test.Suite.Setup[0].Name != "POST https://shop.local/login" {
+		t.Errorf("Expected the file setup to be loaded, got %+v", test.Suite.Setup)
+	}
+	if len(test.Setup) != 1 || test.Setup[0].Method != "GET" || test.Setup[0].Extract["userID"].JSON != "users.*.id" {
+		t.Errorf("Expected the test setup to be loaded, got %+v", test.Setup)
+	}
+	if len(test.Teardown) != 1 || test.Teardown[0].Method != "DELETE" {
+		t.Errorf("Expected the test teardown to be loaded, got %+v", test.Teardown)
+	}
+	c, ok := test.Specs[0].Components[1].(randurl.VariableComponent)
+	if !ok || c.Name != "userID" || c.Variables != test.Variables {
+		t.Errorf("Expected a variable component, got %#v", test.Specs[0].Components[1])
+	}
+	if test.Specs[0].Name != "https://shop.local/users/{userID}" {
+		t.Errorf("Unexpected spec name %s", test.Specs[0].Name)
+	}
+
+	invalid := map[string][2]string{
+		"unknown component variable": {"[]", "- {type: extracted, name: userID}"},
+		"unknown placeholder":        {"[{url: 'https://shop.local/users/{{userID}}'}]", ""},
+		"invalid url":                {"[{url: shop.local/users}]", ""},
+		"repeat and forEach":         {"[{url: 'https://shop.local/', repeat: 2, forEach: token}]", ""},
+		"unknown forEach":            {"[{url: 'https://shop.local/', forEach: userID}]", ""},
+		"two extractors":             {"[{url: 'https://shop.local/', extract: {id: {json: id, header: X-Id}}}]", ""},
+		"invalid regex":              {"[{url: 'https://shop.local/', extract: {id: {regex: '('}}}]", ""},
+		"invalid status":             {"[{url: 'https://shop.local/', expectStatus: [42]}]", ""},
+	}
+	for name, c := range invalid {
+		if _, err := load(c[0], c[1]); err == nil {
+			t.Errorf("Expected an error for %s", name)
+		}
+	}
+}
+
+func TestLoadTests_Formats(t *testing.T) {
+	documents := map[string]string{
+		FormatYAML: `defaults:
+  scheme: https
+  host: shop.local
+tests:
+- id: items
+  numRequests: 5
+  concurrency: 2
+  duration: 1m
+  headers: {Accept: application/json}
+  thresholds:
+    maxPercentiles: {99: 500ms}
+  urlSpecs:
+  - uriComponents:
+    - {type: string, value: item}
+    - {type: integer, min: 1, max: 100}
+`,
+		FormatJSON: `{
+	"defaults": {"scheme": "https", "host": "shop.local"},
+	"tests": [{
+		"id": "items",
+		"numRequests": 5,
+		"concurrency": 2,
+		"duration": "1m",
+		"headers": {"Accept": "application/json"},
+		"thresholds": {"maxPercentiles": {"99": "500ms"}},
+		"urlSpecs": [{
+			"uriComponents": [
+				{"type": "string", "value": "item"},
+				{"type": "integer", "min": 1, "max": 100}
+			]
+		}]
+	}]
+}
+`,
+		FormatTOML: `[defaults]
+scheme = "https"
+host = "shop.local"
+
+[[tests]]
+id = "items"
+numRequests = 5
+concurrency = 2
+duration = "1m"
+headers = { Accept = "application/json" }
+thresholds = { maxPercentiles = { 99 = "500ms" } }
+
+[[tests.urlSpecs]]
+uriComponents = [
+  { type = "string", value = "item" },
+  { type = "integer", min = 1, max = 100 },
+]
+`,
+	}
+
+	for _, format := range Formats() {
+		tmpFile := writeTempFile(t, documents[format])
+		tests, err := LoadTests(tmpFile, LoadOptions{Format: format})
+		os.Remove(tmpFile)
+		if err != nil {
+			t.Errorf("%s: %s", format, err)
+			continue
+		}
+		test := tests[0]
+		if test.ID != "items" || test.NumRequests != 5 || test.Concurrency != 2 || test.Duration != time.Minute ||
+			test.Header.Get("Accept") != "application/json" || test.Thresholds.MaxPercentiles[0.99] != 500*time.Millisecond {
+			t.Errorf("%s: test loaded incorrectly: %+v", format, test)
+		}
+		if len(test.Specs) != 1 || test.Specs[0].Name != "https://shop.local/item/{integer}" {
+			t.Errorf("%s: urlSpecs loaded incorrectly: %+v", format, test.Specs)
+		}
+	}
+
+	// The format is determined by the extension, errors in JSON files
+	// have positions
+	f, err := ioutil.TempFile(os.TempDir(), "tests-*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"tests": [{"id": "items", "numRequests": -1, "concurrency": 1, "urlSpecs": [{"scheme": "https", "host": "shop.local"}]}]}`)
+	f.Close()
+	defer os.Remove(f.Name())
+	_, err = LoadTests(f.Name(), LoadOptions{})
+	if errs, ok := err.(ValidationErrors); !ok || len(errs) != 1 || errs[0].Path != "tests[0].numRequests" || errs[0].Line != 1 || errs[0].Column != 43 {
+		t.Errorf("Expected an error for numRequests at 1:43, got %v", err)
+	}
+
+	tmpFile := writeTempFile(t, "[[tests]]\nid = \"items\"\nnumRequests = \n")
+	defer os.Remove(tmpFile)
+	_, err = LoadTests(tmpFile, LoadOptions{Format: FormatTOML})
+	if errs, ok := err.(ValidationErrors); !ok || len(errs) != 1 || errs[0].Line != 3 {
+		t.Errorf("Expected a syntax error in line 3, got %v", err)
+	}
+
+	if _, err := LoadTests(tmpFile, LoadOptions{Format: "xml"}); err == nil {
+		t.Error("Expected an error for an unknown format")
+	}
+}
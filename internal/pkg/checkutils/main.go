@@ -0,0 +1,121 @@
+package checkutils
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/pbaettig/request0r/internal/app"
+	"github.com/pbaettig/request0r/internal/pkg/resultutils"
+	"github.com/pbaettig/request0r/internal/pkg/statutils"
+)
+
+// CheckResult is the outcome of evaluating a single threshold
+type CheckResult struct {
+	Name     string
+	Expected string
+	Measured string
+	Passed   bool
+}
+
+func (c CheckResult) String() string {
+	status := "passed"
+	if !c.Passed {
+		status = "FAILED"
+	}
+	return fmt.Sprintf("%s %s: measured %s, expected %s", c.Name, status, c.Measured, c.Expected)
+}
+
+// Evaluate checks the results of run against the Thresholds configured
+// for its Test and returns one CheckResult per configured threshold. A
+// failed setup is reported as a failed check as well.
+func Evaluate(run app.TestRun) []CheckResult {
+	th := run.Test.Thresholds
+	var checks []CheckResult
+
+	if run.SetupError != nil {
+		checks = append(checks, CheckResult{
+			Name:     "setup",
+			Expected: "success",
+			Measured: run.SetupError.Error(),
+		})
+	}
+
+	if th.MaxErrorPercent != nil {
+		errorPercent := 0.0
+		if len(run.Results) > 0 {
+			errorPercent = float64(len(resultutils.GetErrors(run.Results))) * 100.0 / float64(len(run.Results))
+		}
+		checks = append(checks, CheckResult{
+			Name:     "error rate",
+			Expected: fmt.Sprintf("<= %.1f%%", *th.MaxErrorPercent),
+			Measured: fmt.Sprintf("%.1f%%", errorPercent),
+			Passed:   errorPercent <= *th.MaxErrorPercent,
+		})
+	}
+
+	if th.MinRequestsPerSecond > 0 {
+		rps := statutils.SumRequestsPerSecond(run.Stats)
+		checks = append(checks, CheckResult{
+			Name:     "throughput",
+			Expected: fmt.Sprintf(">= %.1f requests/second", th.MinRequestsPerSecond),
+			Measured: fmt.Sprintf("%.1f requests/second", rps),
+			Passed:   rps >= th.MinRequestsPerSecond,
+		})
+	}
+
+	var percentiles []float64
+	for p := range th.MaxPercentiles {
+		percentiles = append(percentiles, p)
+	}
+	sort.Sort(sort.Reverse(sort.Float64Slice(percentiles)))
+	for _, p := range percentiles {
+		max := th.MaxPercentiles[p]
+		d := resultutils.GetDurationPercentile(run.Results, p)
+		checks = append(checks, CheckResult{
+			Name:     fmt.Sprintf("p%g response duration", math.Round(p*1000)/10),
+			Expected: fmt.Sprintf("<= %s", max),
+			Measured: d.String(),
+			Passed:   len(run.Results) > 0 && d <= max,
+		})
+	}
+
+	if len(th.AllowedStatusCodes) > 0 {
+		allowed := make(map[int]bool)
+		for _, c := range th.AllowedStatusCodes {
+			allowed[c] = true
+		}
+		var unexpected []string
+		for code, count := range resultutils.CountResponseStatusCodes(run.Results) {
+			if !allowed[code] {
+				unexpected = append(unexpected, fmt.Sprintf("HTTP%d (%d)", code, count))
+			}
+		}
+		sort.Strings(unexpected)
+
+		measured := "only allowed status codes"
+		if len(unexpected) > 0 {
+			measured = strings.Join(unexpected, ", ")
+		}
+		checks = append(checks, CheckResult{
+			Name:     "status codes",
+			Expected: fmt.Sprintf("one of %v", th.AllowedStatusCodes),
+			Measured: measured,
+			Passed:   len(unexpected) == 0,
+		})
+	}
+
+	return checks
+}
+
+// Failed returns all CheckResults in cs that did not pass
+func Failed(cs []CheckResult) []CheckResult {
+	var failed []CheckResult
+	for _, c := range cs {
+		if !c.Passed {
+			failed = append(failed, c)
+		}
+	}
+	return failed
+}
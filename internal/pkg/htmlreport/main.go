@@ -0,0 +1,529 @@
+package htmlreport
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pbaettig/request0r/internal/app"
+	"github.com/pbaettig/request0r/internal/pkg/resultutils"
+	"github.com/pbaettig/request0r/internal/pkg/statutils"
+)
+
+const (
+	chartWidth  = 640
+	chartHeight = 240
+	chartMargin = 48
+
+	histogramBins  = 20
+	maxTimeBuckets = 60
+	maxErrors      = 10
+)
+
+type specView struct {
+	Name       string
+	URL        string
+	Components []string
+	Requests   int
+	Percent    float64
+	Expected   float64
+	Results    resultsView
+}
+
+type percentileView struct {
+	Percentile int
+	Duration   time.Duration
+}
+
+type statusView struct {
+	Code    int
+	Count   int
+	Percent float64
+}
+
+// resultsView holds the statistics shown for a whole test as well as for
+// each of its URLSpecs
+type resultsView struct {
+	Processed int
+
+	Percentiles []percentileView
+
+	ErrorCount   int
+	ErrorPercent float64
+	Errors       []string
+
+	StatusCodes []statusView
+	StatusTotal int
+}
+
+type testView struct {
+	ID                      string
+	Source                  string
+	NumRequests             int
+	Duration                time.Duration
+	Method                  string
+	Weighted                bool
+	Concurrency             int
+	TargetRequestsPerSecond int
+	Specs                   []specView
+	SetupError              string
+
+	Workers           []app.WorkerStats
+	RequestsPerSecond float64
+	Results           resultsView
+
+	Histogram          template.HTML
+	LatencyOverTime    template.HTML
+	ThroughputOverTime template.HTML
+	StatusChart        template.HTML
+}
+
+type reportView struct {
+	Generated time.Time
+	Duration  time.Duration
+	Tests     []testView
+}
+
+var reportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>rq0r report</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+h1, h2, h3, h4 { font-weight: normal; }
+h2 { border-bottom: 1px solid #ccc; padding-top: 1em; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+th, td { text-align: left; padding: 2px 12px 2px 0; }
+td.num { text-align: right; }
+svg { display: block; margin-bottom: 1em; }
+svg text { font-size: 11px; fill: #444; }
+.charts { display: flex; flex-wrap: wrap; gap: 1em; }
+</style>
+</head>
+<body>
+<h1>rq0r report</h1>
+<p>Ran {{len .Tests}} tests in {{.Duration}}, generated {{.Generated.Format "2006-01-02 15:04:05 MST"}}.</p>
+{{range .Tests}}
+<h2>Results for test "{{.ID}}"</h2>
+{{if .SetupError}}<p>The test didn't run, its setup failed: {{.SetupError}}</p>{{end}}
+<h3>Configuration</h3>
+<table>
+{{if .Source}}<tr><th>Defined in</th><td>{{.Source}}</td></tr>{{end}}
+{{if .NumRequests}}<tr><th>{{if .Weighted}}Total requests{{else}}Requests per URLSpec{{end}}</th><td class="num">{{.NumRequests}}</td></tr>{{end}}
+{{if .Duration}}<tr><th>Duration</th><td class="num">{{.Duration}}</td></tr>{{end}}
+<tr><th>Method</th><td>{{.Method}}</td></tr>
+<tr><th>Concurrency</th><td class="num">{{.Concurrency}}</td></tr>
+<tr><th>Target requests/second</th><td class="num">{{if .TargetRequestsPerSecond}}{{.TargetRequestsPerSecond}}{{else}}unthrottled{{end}}</td></tr>
+</table>
+<table>
+<tr><th>URLSpec</th><th>URL</th><th>Components</th><th>Requests</th><th>Share</th><th>Expected share</th></tr>
+{{range .Specs}}<tr><td>{{.Name}}</td><td>{{.URL}}</td><td>{{range $i, $c := .Components}}{{if $i}} / {{end}}{{$c}}{{end}}</td><td class="num">{{.Requests}}</td><td class="num">{{printf "%.1f" .Percent}}%</td><td class="num">{{printf "%.1f" .Expected}}%</td></tr>
+{{end}}</table>
+
+<h3>Worker Stats</h3>
+<table>
+<tr><th>Worker</th><th>Requests/second</th><th>Requests processed</th><th>Runtime</th></tr>
+{{range .Workers}}<tr><td>{{.ID}}</td><td class="num">{{printf "%.1f" .RequestsPerSecond}}</td><td class="num">{{.RequestsProcessed}}</td><td class="num">{{.Runtime}}</td></tr>
+{{end}}<tr><th>Total</th><th class="num">{{printf "%.1f" .RequestsPerSecond}}</th><th class="num">{{.Results.Processed}}</th><th></th></tr>
+</table>
+
+<h3>All requests</h3>
+{{template "results" .Results}}
+{{if gt (len .Specs) 1}}{{range .Specs}}
+<h3>Results for URLSpec "{{.Name}}"</h3>
+{{template "results" .Results}}
+{{end}}{{end}}
+<h3>Charts</h3>
+<div class="charts">
+{{.Histogram}}
+{{.LatencyOverTime}}
+{{.ThroughputOverTime}}
+{{.StatusChart}}
+</div>
+{{end}}
+</body>
+</html>
+{{define "results"}}
+<h4>Response duration Percentiles</h4>
+{{if .Processed}}<table>
+{{range .Percentiles}}<tr><th>{{.Percentile}}%</th><td class="num">{{.Duration}}</td></tr>
+{{end}}</table>
+{{else}}<p>No requests were made.</p>
+{{end}}
+<h4>Errors</h4>
+{{if .ErrorCount}}<p>{{printf "%.1f" .ErrorPercent}}% ({{.ErrorCount}}/{{.Processed}}) of requests failed.{{if gt .ErrorCount (len .Errors)}} First {{len .Errors}} error messages:{{end}}</p>
+<ul>
+{{range .Errors}}<li>{{.}}</li>
+{{end}}</ul>
+{{else}}<p>No errors occured.</p>
+{{end}}
+<h4>Response Status codes</h4>
+<table>
+{{range .StatusCodes}}<tr><th>HTTP{{.Code}}</th><td class="num">{{printf "%.1f" .Percent}}%</td><td class="num">{{.Count}}</td></tr>
+{{end}}<tr><th>Total</th><td></td><td class="num">{{.StatusTotal}}</td></tr>
+</table>
+{{end}}`))
+
+// Write renders a self-contained HTML report for all runs to w
+func Write(w io.Writer, runs []app.TestRun, duration time.Duration) error {
+	rv := reportView{
+		Generated: time.Now(),
+		Duration:  duration,
+	}
+	for _, run := range runs {
+		rv.Tests = append(rv.Tests, newTestView(run))
+	}
+
+	return reportTemplate.Execute(w, rv)
+}
+
+func newTestView(run app.TestRun) testView {
+	t := run.Test
+	tv := testView{
+		ID:                      t.ID,
+		Source:                  t.Source,
+		NumRequests:             t.NumRequests,
+		Duration:                t.Duration,
+		Method:                  t.Method,
+		Weighted:                t.IsWeighted(),
+		Concurrency:             t.Concurrency,
+		TargetRequestsPerSecond: t.TargetRequestsPerSecond,
+		Workers:                 run.Stats,
+		RequestsPerSecond:       statutils.SumRequestsPerSecond(run.Stats),
+		Results:                 newResultsView(run.Results),
+	}
+
+	if tv.Method == "" {
+		tv.Method = "GET"
+	}
+	if run.SetupError != nil {
+		tv.SetupError = run.SetupError.Error()
+	}
+
+	specCounts := resultutils.CountSpecs(run.Results)
+	for i, s := range t.Specs {
+		sv := specView{
+			Name:     s.Name,
+			URL:      fmt.Sprintf("%s://%s", s.Scheme, s.Host),
+			Requests: specCounts[i],
+			Expected: t.SpecShare(i) * 100,
+			Results:  newResultsView(resultutils.FilterSpec(run.Results, i)),
+		}
+		if len(run.Results) > 0 {
+			sv.Percent = float64(specCounts[i]) * 100.0 / float64(len(run.Results))
+		}
+		for _, c := range s.Components {
+			sv.Components = append(sv.Components, describeComponent(c))
+		}
+		tv.Specs = append(tv.Specs, sv)
+	}
+
+	tv.Histogram = latencyHistogram(run.Results)
+	tv.LatencyOverTime, tv.ThroughputOverTime = timeSeries(run.Results)
+	tv.StatusChart = statusChart(tv.Results.StatusCodes)
+
+	return tv
+}
+
+func newResultsView(rs []app.WorkerResult) resultsView {
+	rv := resultsView{Processed: len(rs)}
+	if len(rs) == 0 {
+		return rv
+	}
+
+	pd := resultutils.GetDurationPercentiles(rs)
+	for _, p := range []float64{0.99, 0.95, 0.9, 0.5, 0.1, 0.01} {
+		rv.Percentiles = append(rv.Percentiles, percentileView{
+			Percentile: int(math.Round(p * 100)),
+			Duration:   pd[p],
+		})
+	}
+
+	errors := resultutils.GetErrors(rs)
+	rv.ErrorCount = len(errors)
+	rv.ErrorPercent = float64(len(errors)) * 100.0 / float64(len(rs))
+	for i, e := range errors {
+		if i == maxErrors {
+			break
+		}
+		rv.Errors = append(rv.Errors, e.Error())
+	}
+
+	for s, c := range resultutils.CountResponseStatusCodes(rs) {
+		rv.StatusCodes = append(rv.StatusCodes, statusView{
+			Code:    s,
+			Count:   c,
+			Percent: float64(c) * 100.0 / float64(len(rs)),
+		})
+		rv.StatusTotal += c
+	}
+	sort.Slice(rv.StatusCodes, func(i, j int) bool {
+		return rv.StatusCodes[i].Code < rv.StatusCodes[j].Code
+	})
+
+	return rv
+}
+
+// describeComponent returns a short, human readable description of c
+func describeComponent(c fmt.Stringer) string {
+	name := fmt.Sprintf("%T", c)
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		name = name[i+1:]
+	}
+	if name == "StringComponent" {
+		return c.String()
+	}
+	return "{" + name + "}"
+}
+
+// latencyHistogram buckets the response durations of rs into histogramBins
+// equally wide bins between the fastest and the slowest response
+func latencyHistogram(rs []app.WorkerResult) template.HTML {
+	if len(rs) == 0 {
+		return ""
+	}
+	min, max := rs[0].RequestDuration, rs[0].RequestDuration
+	for _, r := range rs {
+		if r.RequestDuration < min {
+			min = r.RequestDuration
+		}
+		if r.RequestDuration > max {
+			max = r.RequestDuration
+		}
+	}
+
+	width := (max - min) / histogramBins
+	if width <= 0 {
+		width = 1
+	}
+	counts := make([]float64, histogramBins)
+	for _, r := range rs {
+		i := int((r.RequestDuration - min) / width)
+		if i >= histogramBins {
+			i = histogramBins - 1
+		}
+		counts[i]++
+	}
+
+	labels := make([]string, histogramBins)
+	for i := range labels {
+		labels[i] = roundDuration(min + time.Duration(i)*width).String()
+	}
+
+	return barChart("Latency histogram", labels, counts, "requests")
+}
+
+// timeSeries computes the mean/max latency and the throughput of rs over
+// the runtime of the test and returns them as two line charts
+func timeSeries(rs []app.WorkerResult) (latency template.HTML, throughput template.HTML) {
+	if len(rs) == 0 {
+		return "", ""
+	}
+	start, end := rs[0].Start, rs[0].Start.Add(rs[0].RequestDuration)
+	for _, r := range rs {
+		if r.Start.Before(start) {
+			start = r.Start
+		}
+		if f := r.Start.Add(r.RequestDuration); f.After(end) {
+			end = f
+		}
+	}
+
+	n := len(rs) / 5
+	if n > maxTimeBuckets {
+		n = maxTimeBuckets
+	}
+	if n < 1 {
+		n = 1
+	}
+	width := end.Sub(start) / time.Duration(n)
+	if width <= 0 {
+		width = 1
+	}
+
+	sums := make([]time.Duration, n)
+	maxs := make([]time.Duration, n)
+	started := make([]int, n)
+	finished := make([]int, n)
+	bucket := func(t time.Time) int {
+		i := int(t.Sub(start) / width)
+		if i >= n {
+			i = n - 1
+		}
+		return i
+	}
+	for _, r := range rs {
+		i := bucket(r.Start)
+		sums[i] += r.RequestDuration
+		started[i]++
+		if r.RequestDuration > maxs[i] {
+			maxs[i] = r.RequestDuration
+		}
+		finished[bucket(r.Start.Add(r.RequestDuration))]++
+	}
+
+	xs := make([]float64, n)
+	mean := make([]float64, n)
+	max := make([]float64, n)
+	rps := make([]float64, n)
+	for i := 0; i < n; i++ {
+		xs[i] = (time.Duration(i)*width + width/2).Seconds()
+		if started[i] > 0 {
+			mean[i] = milliseconds(sums[i] / time.Duration(started[i]))
+			max[i] = milliseconds(maxs[i])
+		} else {
+			mean[i], max[i] = math.NaN(), math.NaN()
+		}
+		rps[i] = float64(finished[i]) / width.Seconds()
+	}
+
+	latency = lineChart("Latency over time", "seconds", "ms", []series{
+		{Name: "mean", Color: "#1f77b4", X: xs, Y: mean},
+		{Name: "max", Color: "#d62728", X: xs, Y: max},
+	})
+	throughput = lineChart("Throughput over time", "seconds", "requests/second", []series{
+		{Name: "completed", Color: "#2ca02c", X: xs, Y: rps},
+	})
+	return
+}
+
+func statusChart(svs []statusView) template.HTML {
+	if len(svs) == 0 {
+		return ""
+	}
+	labels := make([]string, len(svs))
+	counts := make([]float64, len(svs))
+	for i, sv := range svs {
+		labels[i] = fmt.Sprintf("HTTP%d", sv.Code)
+		counts[i] = float64(sv.Count)
+	}
+	return barChart("Status code distribution", labels, counts, "responses")
+}
+
+type series struct {
+	Name  string
+	Color string
+	X, Y  []float64
+}
+
+// barChart renders values as an inline SVG bar chart
+func barChart(title string, labels []string, values []float64, unit string) template.HTML {
+	b := new(strings.Builder)
+	yMax := maxValue(values)
+	openChart(b, title, unit, yMax)
+
+	plotWidth := float64(chartWidth - 2*chartMargin)
+	plotHeight := float64(chartHeight - 2*chartMargin)
+	slot := plotWidth / float64(len(values))
+	labelEvery := int(math.Ceil(float64(len(values)) / 8))
+	for i, v := range values {
+		h := v / yMax * plotHeight
+		x := chartMargin + float64(i)*slot
+		fmt.Fprintf(b, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="#1f77b4"><title>%s: %s</title></rect>`,
+			x+1, chartMargin+plotHeight-h, math.Max(slot-2, 1), h, template.HTMLEscapeString(labels[i]), formatValue(v))
+		if i%labelEvery == 0 {
+			fmt.Fprintf(b, `<text x="%.1f" y="%d" text-anchor="middle">%s</text>`,
+				x+slot/2, chartHeight-chartMargin+14, template.HTMLEscapeString(labels[i]))
+		}
+	}
+
+	b.WriteString("</svg>")
+	return template.HTML(b.String())
+}
+
+// lineChart renders ss as an inline SVG line chart, NaN values leave gaps
+func lineChart(title, xUnit, yUnit string, ss []series) template.HTML {
+	b := new(strings.Builder)
+	xMax, yMax := 0.0, 0.0
+	for _, s := range ss {
+		xMax = math.Max(xMax, maxValue(s.X))
+		yMax = math.Max(yMax, maxValue(s.Y))
+	}
+	if xMax == 0 {
+		xMax = 1
+	}
+	openChart(b, title, yUnit, yMax)
+
+	plotWidth := float64(chartWidth - 2*chartMargin)
+	plotHeight := float64(chartHeight - 2*chartMargin)
+	for i, s := range ss {
+		var points []string
+		flush := func() {
+			if len(points) > 0 {
+				fmt.Fprintf(b, `<polyline fill="none" stroke="%s" stroke-width="1.5" points="%s"/>`, s.Color, strings.Join(points, " "))
+			}
+			points = points[:0]
+		}
+		for j := range s.X {
+			if math.IsNaN(s.Y[j]) {
+				flush()
+				continue
+			}
+			points = append(points, fmt.Sprintf("%.1f,%.1f",
+				chartMargin+s.X[j]/xMax*plotWidth,
+				chartMargin+plotHeight-s.Y[j]/yMax*plotHeight))
+		}
+		flush()
+
+		fmt.Fprintf(b, `<text x="%d" y="%d" fill="%s" style="fill:%s">%s</text>`,
+			chartWidth-chartMargin-60*(len(ss)-i), chartMargin-8, s.Color, s.Color, template.HTMLEscapeString(s.Name))
+	}
+
+	fmt.Fprintf(b, `<text x="%d" y="%d" text-anchor="start">0</text>`, chartMargin, chartHeight-chartMargin+14)
+	fmt.Fprintf(b, `<text x="%d" y="%d" text-anchor="end">%s %s</text>`, chartWidth-chartMargin, chartHeight-chartMargin+14, formatValue(xMax), xUnit)
+
+	b.WriteString("</svg>")
+	return template.HTML(b.String())
+}
+
+// openChart writes the opening svg tag, the title, the axes and
+// horizontal grid lines to b
+func openChart(b *strings.Builder, title, unit string, yMax float64) {
+	fmt.Fprintf(b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`, chartWidth, chartHeight, chartWidth, chartHeight)
+	fmt.Fprintf(b, `<text x="%d" y="%d" style="font-size:13px">%s (%s)</text>`, chartMargin, chartMargin/2, template.HTMLEscapeString(title), template.HTMLEscapeString(unit))
+
+	plotHeight := float64(chartHeight - 2*chartMargin)
+	for i := 0; i <= 4; i++ {
+		y := chartMargin + plotHeight - plotHeight*float64(i)/4
+		fmt.Fprintf(b, `<line x1="%d" y1="%.1f" x2="%d" y2="%.1f" stroke="#ddd"/>`, chartMargin, y, chartWidth-chartMargin, y)
+		fmt.Fprintf(b, `<text x="%d" y="%.1f" text-anchor="end">%s</text>`, chartMargin-4, y+4, formatValue(yMax*float64(i)/4))
+	}
+	fmt.Fprintf(b, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="#444"/>`, chartMargin, chartHeight-chartMargin, chartWidth-chartMargin, chartHeight-chartMargin)
+}
+
+func maxValue(vs []float64) float64 {
+	max := 0.0
+	for _, v := range vs {
+		if !math.IsNaN(v) && v > max {
+			max = v
+		}
+	}
+	if max == 0 {
+		return 1
+	}
+	return max
+}
+
+func formatValue(v float64) string {
+	return fmt.Sprintf("%.3g", v)
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func roundDuration(d time.Duration) time.Duration {
+	switch {
+	case d > time.Second:
+		return d.Round(10 * time.Millisecond)
+	case d > time.Millisecond:
+		return d.Round(10 * time.Microsecond)
+	default:
+		return d.Round(time.Microsecond)
+	}
+}
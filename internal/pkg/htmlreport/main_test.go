@@ -0,0 +1,63 @@
+package htmlreport
+
+import (
+	"bytes"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pbaettig/request0r/internal/app"
+	"github.com/pbaettig/request0r/pkg/randurl"
+)
+
+func TestWrite(t *testing.T) {
+	test := &app.Test{
+		ID:          "items",
+		NumRequests: 2,
+		Concurrency: 1,
+		Specs: []randurl.URLSpec{
+			{Name: "list", Scheme: "https", Host: "shop.local", Components: []randurl.PathComponent{randurl.StringComponent("items")}},
+			{Name: "<detail>", Scheme: "https", Host: "shop.local"},
+		},
+	}
+	start := time.Now()
+	run := app.TestRun{
+		Test: test,
+		Results: []app.WorkerResult{
+			{URL: "https://shop.local/items", Spec: 0, Start: start, RequestDuration: 10 * time.Millisecond, StatusCode: 200},
+			{URL: "https://shop.local/items", Spec: 0, Start: start.Add(time.Second), RequestDuration: 20 * time.Millisecond, StatusCode: 503},
+			{URL: "https://shop.local/?q=<script>", Spec: 1, Start: start, RequestDuration: 5 * time.Millisecond, StatusCode: 404},
+			{URL: "https://shop.local/?q=<script>", Spec: 1, Start: start.Add(time.Second), RequestDuration: time.Second,
+				Error: &url.Error{Op: "Get", URL: "https://shop.local/?q=<script>", Err: errors.New("timeout & <reset>")}},
+		},
+		Stats: []app.WorkerStats{{ID: "items-0", RequestsProcessed: 4, RequestsPerSecond: 2, Runtime: 2 * time.Second}},
+	}
+
+	var b bytes.Buffer
+	if err := Write(&b, []app.TestRun{run}, 2*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	report := b.String()
+
+	for _, s := range []string{
+		`<h2>Results for test "items"</h2>`,
+		`<h3>Results for URLSpec "list"</h3>`,
+		`<h3>Results for URLSpec "&lt;detail&gt;"</h3>`,
+		`q=&lt;script&gt;`,
+		`timeout &amp; &lt;reset&gt;`,
+		`<h4>Errors</h4>`,
+		`<h4>Response Status codes</h4>`,
+		`503`,
+	} {
+		if !strings.Contains(report, s) {
+			t.Errorf("Expected the report to contain %s", s)
+		}
+	}
+	for _, s := range []string{"<script>", "<reset>", "<detail>"} {
+		if strings.Contains(report, s) {
+			t.Errorf("%s is not escaped", s)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package junit
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/pbaettig/request0r/internal/app"
+	"github.com/pbaettig/request0r/internal/pkg/checkutils"
+	"github.com/pbaettig/request0r/internal/pkg/resultutils"
+	"github.com/pbaettig/request0r/internal/pkg/statutils"
+)
+
+// maxErrors is the number of error messages included in a failure
+const maxErrors = 10
+
+type testSuites struct {
+	XMLName  xml.Name    `xml:"testsuites"`
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Time     float64     `xml:"time,attr"`
+	Suites   []testSuite `xml:"testsuite"`
+}
+
+type testSuite struct {
+	Name      string     `xml:"name,attr"`
+	Tests     int        `xml:"tests,attr"`
+	Failures  int        `xml:"failures,attr"`
+	Time      float64    `xml:"time,attr"`
+	Timestamp string     `xml:"timestamp,attr"`
+	TestCases []testCase `xml:"testcase"`
+}
+
+type testCase struct {
+	Name       string   `xml:"name,attr"`
+	ClassName  string   `xml:"classname,attr"`
+	Assertions int      `xml:"assertions,attr"`
+	Time       float64  `xml:"time,attr"`
+	Failure    *failure `xml:"failure,omitempty"`
+	SystemOut  string   `xml:"system-out,omitempty"`
+}
+
+type failure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// Write renders a JUnit XML report for all runs to w. Every Test becomes
+// a test case and every configured threshold one of its assertions.
+func Write(w io.Writer, runs []app.TestRun, start time.Time, duration time.Duration) error {
+	suite := testSuite{
+		Name:      "rq0r",
+		Time:      duration.Seconds(),
+		Timestamp: start.Format("2006-01-02T15:04:05"),
+	}
+
+	for _, run := range runs {
+		suite.TestCases = append(suite.TestCases, newTestCase(run))
+		suite.Tests++
+		if suite.TestCases[len(suite.TestCases)-1].Failure != nil {
+			suite.Failures++
+		}
+	}
+
+	report := testSuites{
+		Name:     suite.Name,
+		Tests:    suite.Tests,
+		Failures: suite.Failures,
+		Time:     suite.Time,
+		Suites:   []testSuite{suite},
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func newTestCase(run app.TestRun) testCase {
+	_, runtime := statutils.MaxRuntime(run.Stats)
+	checks := checkutils.Evaluate(run)
+	tc := testCase{
+		Name:       run.Test.ID,
+		ClassName:  "rq0r",
+		Assertions: len(checks),
+		Time:       runtime.Seconds(),
+	}
+
+	out := new(strings.Builder)
+	for _, c := range checks {
+		fmt.Fprintln(out, c)
+	}
+
+	failed := checkutils.Failed(checks)
+	if len(failed) == 0 {
+		tc.SystemOut = out.String()
+		return tc
+	}
+
+	var messages []string
+	text := new(strings.Builder)
+	for _, c := range failed {
+		messages = append(messages, fmt.Sprintf("%s: measured %s, expected %s", c.Name, c.Measured, c.Expected))
+		fmt.Fprintln(text, c)
+	}
+
+	errors := resultutils.GetErrors(run.Results)
+	if len(errors) > 0 {
+		fmt.Fprintf(text, "\n%d of %d requests failed.", len(errors), len(run.Results))
+		if len(errors) > maxErrors {
+			fmt.Fprintf(text, " First %d error messages:", maxErrors)
+			errors = errors[:maxErrors]
+		}
+		fmt.Fprintln(text)
+		for _, e := range errors {
+			fmt.Fprintf(text, "- %s\n", e)
+		}
+	}
+
+	tc.Failure = &failure{
+		Message: strings.Join(messages, "; "),
+		Type:    "ThresholdExceeded",
+		Text:    text.String(),
+	}
+	tc.SystemOut = out.String()
+	return tc
+}
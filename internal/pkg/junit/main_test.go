@@ -0,0 +1,73 @@
+package junit
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pbaettig/request0r/internal/app"
+)
+
+func TestWrite(t *testing.T) {
+	maxErrors := 10.0
+	stats := []app.WorkerStats{{ID: "w-0", RequestsProcessed: 2, RequestsPerSecond: 2, Runtime: time.Second}}
+	failed := &url.Error{Op: "Get", URL: "https://shop.local/<item>", Err: errors.New("connection refused")}
+	runs := []app.TestRun{
+		{
+			Test:    &app.Test{ID: "passing", Thresholds: app.Thresholds{MaxErrorPercent: &maxErrors}},
+			Results: []app.WorkerResult{{StatusCode: 200}, {StatusCode: 200}},
+			Stats:   stats,
+		},
+		{
+			Test:    &app.Test{ID: "errors", Thresholds: app.Thresholds{MaxErrorPercent: &maxErrors}},
+			Results: []app.WorkerResult{{StatusCode: 200}, {Error: failed}},
+			Stats:   stats,
+		},
+		{
+			Test:       &app.Test{ID: "setup"},
+			SetupError: errors.New("login: unexpected status 403 Forbidden"),
+		},
+		{
+			Test: &app.Test{ID: "no thresholds"},
+		},
+	}
+
+	var b bytes.Buffer
+	if err := Write(&b, runs, time.Now(), 3*time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	var report testSuites
+	if err := xml.Unmarshal(b.Bytes(), &report); err != nil {
+		t.Fatalf("Invalid XML: %s\n%s", err, b.String())
+	}
+	if report.Tests != 4 || report.Failures != 2 || len(report.Suites) != 1 {
+		t.Fatalf("Expected 4 tests and 2 failures in 1 testsuite, got %d, %d and %d", report.Tests, report.Failures, len(report.Suites))
+	}
+	suite := report.Suites[0]
+	if suite.Tests != 4 || suite.Failures != 2 || len(suite.TestCases) != 4 {
+		t.Fatalf("Expected 4 testcases with 2 failures, got %d testcases, %d failures", len(suite.TestCases), suite.Failures)
+	}
+
+	cases := suite.TestCases
+	if cases[0].Failure != nil || cases[0].Assertions != 1 {
+		t.Errorf("Expected passing to pass with 1 assertion, got %+v", cases[0])
+	}
+	f := cases[1].Failure
+	if f == nil || f.Message != "error rate: measured 50.0%, expected <= 10.0%" || f.Type != "ThresholdExceeded" {
+		t.Fatalf("Expected a failed error rate check, got %+v", f)
+	}
+	if !strings.Contains(f.Text, "1 of 2 requests failed") || !strings.Contains(f.Text, `Get "https://shop.local/<item>": connection refused`) {
+		t.Errorf("Expected the errors in the failure text, got %s", f.Text)
+	}
+	if f := cases[2].Failure; f == nil || f.Message != "setup: measured login: unexpected status 403 Forbidden, expected success" {
+		t.Errorf("Expected a failed setup, got %+v", f)
+	}
+	if cases[3].Failure != nil || cases[3].Assertions != 0 {
+		t.Errorf("Expected no assertions without thresholds, got %+v", cases[3])
+	}
+}
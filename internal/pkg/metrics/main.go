@@ -0,0 +1,223 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pbaettig/request0r/internal/app"
+	"github.com/pbaettig/request0r/internal/pkg/resultutils"
+)
+
+// DurationBuckets are the upper bounds (in seconds) of the latency histogram
+var DurationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type requestKey struct {
+	spec       int
+	status     int
+	errorClass string
+}
+
+type histogram struct {
+	buckets []uint64
+	count   uint64
+	sum     float64
+}
+
+func (h *histogram) observe(v float64) {
+	if h.buckets == nil {
+		h.buckets = make([]uint64, len(DurationBuckets))
+	}
+	for i, b := range DurationBuckets {
+		if v <= b {
+			h.buckets[i]++
+		}
+	}
+	h.count++
+	h.sum += v
+}
+
+type testMetrics struct {
+	test      *app.Test
+	start     time.Time
+	last      time.Time
+	completed uint64
+	requests  map[requestKey]uint64
+	durations map[int]*histogram
+}
+
+// Collector aggregates the results of running Tests and exposes them
+// in the Prometheus text format
+type Collector struct {
+	mu    sync.Mutex
+	tests map[string]*testMetrics
+	order []string
+}
+
+// NewCollector returns an empty Collector
+func NewCollector() *Collector {
+	return &Collector{tests: make(map[string]*testMetrics)}
+}
+
+// Register makes t known to the Collector, it should be called right
+// before t is started
+func (c *Collector) Register(t *app.Test) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.tests[t.ID]; !ok {
+		c.order = append(c.order, t.ID)
+	}
+	c.tests[t.ID] = &testMetrics{
+		test:      t,
+		start:     time.Now(),
+		requests:  make(map[requestKey]uint64),
+		durations: make(map[int]*histogram),
+	}
+}
+
+// Observe records a single result of t
+func (c *Collector) Observe(t *app.Test, r app.WorkerResult) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	tm, ok := c.tests[t.ID]
+	if !ok {
+		return
+	}
+
+	k := requestKey{spec: r.Spec, errorClass: resultutils.ErrorClass(r.Error)}
+	if r.Error == nil {
+		k.status = r.StatusCode
+	}
+	tm.requests[k]++
+
+	h, ok := tm.durations[r.Spec]
+	if !ok {
+		h = new(histogram)
+		tm.durations[r.Spec] = h
+	}
+	h.observe(r.RequestDuration.Seconds())
+
+	tm.completed++
+	tm.last = time.Now()
+}
+
+// ServeHTTP writes all collected metrics in the Prometheus text format
+func (c *Collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	c.WriteTo(w)
+}
+
+// WriteTo writes all collected metrics in the Prometheus text format to w
+func (c *Collector) WriteTo(w io.Writer) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	b := new(strings.Builder)
+
+	header(b, "rq0r_requests_total", "counter", "Number of completed requests.")
+	for _, id := range c.order {
+		tm := c.tests[id]
+		keys := make([]requestKey, 0, len(tm.requests))
+		for k := range tm.requests {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			if keys[i].spec != keys[j].spec {
+				return keys[i].spec < keys[j].spec
+			}
+			if keys[i].status != keys[j].status {
+				return keys[i].status < keys[j].status
+			}
+			return keys[i].errorClass < keys[j].errorClass
+		})
+		for _, k := range keys {
+			status := ""
+			if k.status != 0 {
+				status = strconv.Itoa(k.status)
+			}
+			fmt.Fprintf(b, "rq0r_requests_total{test=\"%s\",spec=\"%s\",status=\"%s\",error_class=\"%s\"} %d\n",
+				escapeLabel(id), escapeLabel(tm.test.SpecName(k.spec)), status, escapeLabel(k.errorClass), tm.requests[k])
+		}
+	}
+
+	header(b, "rq0r_request_duration_seconds", "histogram", "Response duration of completed requests.")
+	for _, id := range c.order {
+		tm := c.tests[id]
+		specs := make([]int, 0, len(tm.durations))
+		for s := range tm.durations {
+			specs = append(specs, s)
+		}
+		sort.Ints(specs)
+		for _, s := range specs {
+			h := tm.durations[s]
+			labels := fmt.Sprintf("test=\"%s\",spec=\"%s\"", escapeLabel(id), escapeLabel(tm.test.SpecName(s)))
+			for i, le := range DurationBuckets {
+				fmt.Fprintf(b, "rq0r_request_duration_seconds_bucket{%s,le=\"%s\"} %d\n", labels, formatFloat(le), h.buckets[i])
+			}
+			fmt.Fprintf(b, "rq0r_request_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels, h.count)
+			fmt.Fprintf(b, "rq0r_request_duration_seconds_sum{%s} %s\n", labels, formatFloat(h.sum))
+			fmt.Fprintf(b, "rq0r_request_duration_seconds_count{%s} %d\n", labels, h.count)
+		}
+	}
+
+	header(b, "rq0r_requests_in_flight", "gauge", "Number of requests waiting for a response.")
+	for _, id := range c.order {
+		fmt.Fprintf(b, "rq0r_requests_in_flight{test=\"%s\"} %d\n", escapeLabel(id), c.tests[id].test.InFlight())
+	}
+
+	header(b, "rq0r_active_workers", "gauge", "Number of workers that have not finished yet.")
+	for _, id := range c.order {
+		fmt.Fprintf(b, "rq0r_active_workers{test=\"%s\"} %d\n", escapeLabel(id), c.tests[id].test.ActiveWorkers())
+	}
+
+	header(b, "rq0r_target_requests_per_second", "gauge", "Configured target rate of requests per second, 0 if unthrottled.")
+	for _, id := range c.order {
+		fmt.Fprintf(b, "rq0r_target_requests_per_second{test=\"%s\"} %d\n", escapeLabel(id), c.tests[id].test.TargetRequestsPerSecond)
+	}
+
+	header(b, "rq0r_achieved_requests_per_second", "gauge", "Average rate of completed requests per second since the test started.")
+	for _, id := range c.order {
+		tm := c.tests[id]
+		end := time.Now()
+		if !tm.test.IsRunning() && !tm.last.IsZero() {
+			end = tm.last
+		}
+		rps := 0.0
+		if elapsed := end.Sub(tm.start).Seconds(); elapsed > 0 {
+			rps = float64(tm.completed) / elapsed
+		}
+		fmt.Fprintf(b, "rq0r_achieved_requests_per_second{test=\"%s\"} %s\n", escapeLabel(id), formatFloat(rps))
+	}
+
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+func header(b *strings.Builder, name, kind, help string) {
+	fmt.Fprintf(b, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(b, "# TYPE %s %s\n", name, kind)
+}
+
+// escapeLabel escapes a label value for the Prometheus text format, which
+// only knows \\, \" and \n
+func escapeLabel(v string) string {
+	return labelEscaper.Replace(v)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// Close is a no-op, it allows using the Collector as a sink
+func (c *Collector) Close() error {
+	return nil
+}
@@ -0,0 +1,113 @@
+package metrics
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pbaettig/request0r/internal/app"
+	"github.com/pbaettig/request0r/pkg/randurl"
+)
+
+func TestCollector_WriteTo(t *testing.T) {
+	test := &app.Test{
+		ID:                      "café\ttest",
+		TargetRequestsPerSecond: 50,
+		Specs: []randurl.URLSpec{
+			{Name: `item "a"`},
+			{Name: `C:\search` + "\n"},
+		},
+	}
+	results := []app.WorkerResult{
+		{Spec: 0, StatusCode: 200, RequestDuration: 12 * time.Millisecond},
+		{Spec: 1, StatusCode: 404, RequestDuration: 1500 * time.Microsecond},
+		{Spec: 1, RequestDuration: 7 * time.Millisecond, Error: &url.Error{Op: "Get", URL: "http://localhost", Err: errors.New("connection refused")}},
+	}
+
+	c := NewCollector()
+	c.Register(test)
+	time.Sleep(10 * time.Millisecond)
+	for _, r := range results {
+		c.Observe(test, r)
+	}
+
+	b := new(strings.Builder)
+	if _, err := c.WriteTo(b); err != nil {
+		t.Fatal(err)
+	}
+	actual := b.String()
+
+	// Only \, " and newlines are escaped in label values
+	expected := []string{
+		"# TYPE rq0r_requests_total counter",
+		"rq0r_requests_total{test=\"café\ttest\",spec=\"item \\\"a\\\"\",status=\"200\",error_class=\"\"} 1",
+		"rq0r_requests_total{test=\"café\ttest\",spec=\"C:\\\\search\\n\",status=\"404\",error_class=\"\"} 1",
+		"rq0r_requests_total{test=\"café\ttest\",spec=\"C:\\\\search\\n\",status=\"\",error_class=\"connection_refused\"} 1",
+		"# TYPE rq0r_request_duration_seconds histogram",
+		"rq0r_request_duration_seconds_bucket{test=\"café\ttest\",spec=\"item \\\"a\\\"\",le=\"0.01\"} 0",
+		"rq0r_request_duration_seconds_bucket{test=\"café\ttest\",spec=\"item \\\"a\\\"\",le=\"0.025\"} 1",
+		"rq0r_request_duration_seconds_bucket{test=\"café\ttest\",spec=\"item \\\"a\\\"\",le=\"10\"} 1",
+		"rq0r_request_duration_seconds_bucket{test=\"café\ttest\",spec=\"item \\\"a\\\"\",le=\"+Inf\"} 1",
+		"rq0r_request_duration_seconds_sum{test=\"café\ttest\",spec=\"item \\\"a\\\"\"} 0.012",
+		"rq0r_request_duration_seconds_count{test=\"café\ttest\",spec=\"item \\\"a\\\"\"} 1",
+		"rq0r_request_duration_seconds_bucket{test=\"café\ttest\",spec=\"C:\\\\search\\n\",le=\"0.005\"} 1",
+		"rq0r_request_duration_seconds_bucket{test=\"café\ttest\",spec=\"C:\\\\search\\n\",le=\"0.01\"} 2",
+		"rq0r_request_duration_seconds_bucket{test=\"café\ttest\",spec=\"C:\\\\search\\n\",le=\"+Inf\"} 2",
+		"rq0r_request_duration_seconds_count{test=\"café\ttest\",spec=\"C:\\\\search\\n\"} 2",
+		"# TYPE rq0r_requests_in_flight gauge",
+		"rq0r_requests_in_flight{test=\"café\ttest\"} 0",
+		"# TYPE rq0r_active_workers gauge",
+		"rq0r_active_workers{test=\"café\ttest\"} 0",
+		"rq0r_target_requests_per_second{test=\"café\ttest\"} 50",
+	}
+	lines := strings.Split(actual, "\n")
+	for _, e := range expected {
+		found := false
+		for _, l := range lines {
+			if l == e {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Errorf("Missing line %s in\n%s", e, actual)
+		}
+	}
+
+	// Every bucket counts all observations up to its bound, the last one
+	// is +Inf
+	prefix := "rq0r_request_duration_seconds_bucket{test=\"café\ttest\",spec=\"C:\\\\search\\n\",le="
+	var buckets []string
+	for _, l := range lines {
+		if strings.HasPrefix(l, prefix) {
+			buckets = append(buckets, l)
+		}
+	}
+	if len(buckets) != len(DurationBuckets)+1 || !strings.HasPrefix(buckets[len(buckets)-1], prefix+"\"+Inf\"}") {
+		t.Errorf("Expected %d buckets ending with +Inf, got %v", len(DurationBuckets)+1, buckets)
+	}
+	last := -1
+	for _, bucket := range buckets {
+		n, err := strconv.Atoi(bucket[strings.LastIndex(bucket, " ")+1:])
+		if err != nil || n < last {
+			t.Errorf("Buckets are not cumulative: %v", buckets)
+			break
+		}
+		last = n
+	}
+
+	rpsPrefix := "rq0r_achieved_requests_per_second{test=\"café\ttest\"} "
+	rps := -1.0
+	for _, l := range lines {
+		if strings.HasPrefix(l, rpsPrefix) {
+			rps, _ = strconv.ParseFloat(strings.TrimPrefix(l, rpsPrefix), 64)
+		}
+	}
+	// 3 results at least 10ms after the start
+	if rps <= 0 || rps > 300 {
+		t.Errorf("Expected an achieved rate between 0 and 300 requests/second, got %f", rps)
+	}
+}
@@ -3,6 +3,7 @@ package resultutils
 import (
 	"net/url"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/pbaettig/request0r/internal/app"
@@ -27,6 +28,28 @@ func CountResponseStatusCodes(rs []app.WorkerResult) map[int]int {
 	return sc
 }
 
+// CountSpecs returns the number of results per index of the URLSpec
+// they were generated from
+func CountSpecs(rs []app.WorkerResult) map[int]int {
+	sc := make(map[int]int)
+	for _, r := range rs {
+		sc[r.Spec]++
+	}
+	return sc
+}
+
+// FilterSpec returns the results that were generated from the URLSpec
+// with index spec
+func FilterSpec(rs []app.WorkerResult, spec int) []app.WorkerResult {
+	var filtered []app.WorkerResult
+	for _, r := range rs {
+		if r.Spec == spec {
+			filtered = append(filtered, r)
+		}
+	}
+	return filtered
+}
+
 func GetErrors(rs []app.WorkerResult) []*url.Error {
 	var errors []*url.Error
 	for _, r := range rs {
@@ -61,3 +84,50 @@ func GetDurationPercentiles(rs []app.WorkerResult) map[float64]time.Duration {
 
 	return ret
 }
+
+// GetDurationPercentile returns the response duration below which the
+// fraction p (0 < p < 1) of all durations in rs fall
+func GetDurationPercentile(rs []app.WorkerResult, p float64) time.Duration {
+	if len(rs) == 0 {
+		return 0
+	}
+	var durations []int
+	for _, r := range rs {
+		durations = append(durations, int(r.RequestDuration))
+	}
+
+	sort.Ints(durations)
+
+	index := int(float64(len(durations)) * p)
+	if index >= len(durations) {
+		index = len(durations) - 1
+	}
+	return time.Duration(durations[index])
+}
+
+// ErrorClass sorts err into a coarse category suitable for use as
+// metric label, e.g. "timeout" or "connection_refused"
+func ErrorClass(err *url.Error) string {
+	if err == nil {
+		return ""
+	}
+	if err.Timeout() {
+		return "timeout"
+	}
+
+	msg := err.Err.Error()
+	switch {
+	case strings.Contains(msg, "connection refused"):
+		return "connection_refused"
+	case strings.Contains(msg, "connection reset"):
+		return "connection_reset"
+	case strings.Contains(msg, "no such host"), strings.Contains(msg, "server misbehaving"):
+		return "dns"
+	case strings.Contains(msg, "tls:"), strings.Contains(msg, "x509:"):
+		return "tls"
+	case strings.Contains(msg, "EOF"):
+		return "eof"
+	default:
+		return "other"
+	}
+}
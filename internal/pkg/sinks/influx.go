@@ -0,0 +1,89 @@
+package sinks
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pbaettig/request0r/internal/app"
+	"github.com/pbaettig/request0r/internal/pkg/resultutils"
+)
+
+// InfluxDB writes a point per result in the InfluxDB line protocol to
+// a write endpoint via HTTP
+type InfluxDB struct {
+	url         string
+	token       string
+	measurement string
+	client      *http.Client
+	*batcher
+}
+
+// NewInfluxDB returns an InfluxDB sink writing to url every interval,
+// e.g. http://localhost:8086/write?db=rq0r. If token is not empty it is
+// sent as Authorization header.
+func NewInfluxDB(url, token, measurement string, interval time.Duration) *InfluxDB {
+	i := &InfluxDB{
+		url:         url,
+		token:       token,
+		measurement: measurement,
+		client:      &http.Client{Timeout: 10 * time.Second},
+	}
+	i.batcher = newBatcher(interval, 5000, i.send)
+	return i
+}
+
+// Observe records a single result of t
+func (i *InfluxDB) Observe(t *app.Test, r app.WorkerResult) {
+	b := new(strings.Builder)
+	b.WriteString(influxEscape(i.measurement, false))
+	fmt.Fprintf(b, ",test=%s,spec=%s", influxEscape(t.ID, true), influxEscape(t.SpecName(r.Spec), true))
+	if r.Error != nil {
+		fmt.Fprintf(b, ",status=error,error_class=%s", resultutils.ErrorClass(r.Error))
+	} else {
+		fmt.Fprintf(b, ",status=%d", r.StatusCode)
+	}
+	fmt.Fprintf(b, " duration_ms=%s,content_length=%di %d",
+		strconv.FormatFloat(float64(r.RequestDuration)/float64(time.Millisecond), 'f', 3, 64),
+		r.ContentLength, r.Start.UnixNano())
+
+	i.Add(b.String())
+}
+
+func (i *InfluxDB) send(lines []string) error {
+	req, err := http.NewRequest(http.MethodPost, i.url, bytes.NewBufferString(strings.Join(lines, "\n")))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if i.token != "" {
+		req.Header.Set("Authorization", "Token "+i.token)
+	}
+
+	resp, err := i.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("InfluxDB responded with HTTP%d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// influxEscape escapes the characters that have a special meaning in
+// measurement names or tag values
+func influxEscape(s string, tag bool) string {
+	pairs := []string{",", `\,`, " ", `\ `}
+	if tag {
+		pairs = append(pairs, "=", `\=`)
+	}
+	return strings.NewReplacer(pairs...).Replace(s)
+}
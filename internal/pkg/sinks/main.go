@@ -0,0 +1,130 @@
+package sinks
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pbaettig/request0r/internal/app"
+	log "github.com/sirupsen/logrus"
+)
+
+// Sink receives the results of running Tests as they are produced
+type Sink interface {
+	// Observe records a single result of t
+	Observe(t *app.Test, r app.WorkerResult)
+	// Close flushes all pending data and releases the Sink's resources
+	Close() error
+}
+
+// maxPendingBatches is the number of full batches that can wait to be
+// flushed, further batches are dropped
+const maxPendingBatches = 4
+
+// batcher buffers lines and hands them to flush periodically or
+// whenever maxSize lines have been accumulated. flush is only called by
+// the batcher's own goroutine, so a slow receiver never blocks Add, which
+// is called while results are collected. Batches that can't be flushed
+// fast enough are dropped.
+type batcher struct {
+	mu      sync.Mutex
+	lines   []string
+	maxSize int
+	dropped int
+	flush   func([]string) error
+
+	pending chan []string
+	done    chan struct{}
+	closed  chan error
+}
+
+func newBatcher(interval time.Duration, maxSize int, flush func([]string) error) *batcher {
+	b := &batcher{
+		maxSize: maxSize,
+		flush:   flush,
+		pending: make(chan []string, maxPendingBatches),
+		done:    make(chan struct{}),
+		closed:  make(chan error, 1),
+	}
+	go b.run(interval)
+	return b
+}
+
+// run flushes the batches handed over by Add and the buffered lines every
+// interval until the batcher is closed
+func (b *batcher) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case lines := <-b.pending:
+			b.send(lines)
+		case <-ticker.C:
+			b.send(b.take())
+		case <-b.done:
+			// Flush everything left, the error of the last flush is
+			// returned by Close
+			var err error
+			for len(b.pending) > 0 {
+				if lines := <-b.pending; len(lines) > 0 {
+					err = b.flush(lines)
+				}
+			}
+			if lines := b.take(); len(lines) > 0 {
+				err = b.flush(lines)
+			}
+			b.closed <- err
+			return
+		}
+	}
+}
+
+// send flushes lines and logs failures
+func (b *batcher) send(lines []string) {
+	if len(lines) == 0 {
+		return
+	}
+	if err := b.flush(lines); err != nil {
+		log.Warnf("Unable to flush results: %s", err)
+	}
+}
+
+// take returns the buffered lines and empties the buffer
+func (b *batcher) take() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	lines := b.lines
+	b.lines = nil
+	return lines
+}
+
+// Add appends lines to the batch. If it grows too large it is handed to
+// the flushing goroutine, or dropped if too many batches are pending.
+func (b *batcher) Add(lines ...string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.lines = append(b.lines, lines...)
+	if len(b.lines) < b.maxSize {
+		return
+	}
+
+	select {
+	case b.pending <- b.lines:
+	default:
+		b.dropped += len(b.lines)
+	}
+	b.lines = nil
+}
+
+// Close flushes the remaining lines and stops the flushing goroutine
+func (b *batcher) Close() error {
+	close(b.done)
+	err := <-b.closed
+
+	b.mu.Lock()
+	dropped := b.dropped
+	b.mu.Unlock()
+	if dropped > 0 {
+		log.Warnf("Dropped %d lines, results were produced faster than they could be sent", dropped)
+	}
+	return err
+}
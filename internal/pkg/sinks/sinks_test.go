@@ -0,0 +1,152 @@
+package sinks
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pbaettig/request0r/internal/app"
+	"github.com/pbaettig/request0r/pkg/randurl"
+)
+
+var (
+	sinkTest = &app.Test{
+		ID: "sink test",
+		Specs: []randurl.URLSpec{
+			{Name: "item"},
+			{Name: "search,page=1"},
+		},
+	}
+	start   = time.Unix(1500000000, 0)
+	results = []app.WorkerResult{
+		{Spec: 0, Start: start, StatusCode: 200, RequestDuration: 12 * time.Millisecond, ContentLength: 42},
+		{Spec: 1, Start: start, StatusCode: 404, RequestDuration: 1500 * time.Microsecond},
+		{Spec: 1, Start: start, RequestDuration: 3 * time.Millisecond, Error: &url.Error{Op: "Get", URL: "http://localhost", Err: errors.New("connection refused")}},
+	}
+)
+
+func TestStatsD(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Cannot listen on UDP: %s", err)
+	}
+	defer conn.Close()
+
+	s, err := NewStatsD(conn.LocalAddr().String(), "rq0r.", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range results {
+		s.Observe(sinkTest, r)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, maxDatagramSize)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("No datagram received: %s", err)
+	}
+
+	actual := strings.Split(string(buf[:n]), "\n")
+	correct := []string{
+		"rq0r.requests:1|c|#test:sink test,spec:item,status:200",
+		"rq0r.request_duration:12.000|ms|#test:sink test,spec:item,status:200",
+		"rq0r.requests:1|c|#test:sink test,spec:search_page=1,status:404",
+		"rq0r.request_duration:1.500|ms|#test:sink test,spec:search_page=1,status:404",
+		"rq0r.requests:1|c|#test:sink test,spec:search_page=1,status:error,error_class:connection_refused",
+		"rq0r.request_duration:3.000|ms|#test:sink test,spec:search_page=1,status:error,error_class:connection_refused",
+	}
+	if strings.Join(actual, "\n") != strings.Join(correct, "\n") {
+		t.Errorf("Wrong StatsD datagram, wanted\n%s\ngot\n%s", strings.Join(correct, "\n"), strings.Join(actual, "\n"))
+	}
+}
+
+func TestInfluxDB(t *testing.T) {
+	received := make(chan string, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Token secret" {
+			t.Errorf("Wrong Authorization header: %s", r.Header.Get("Authorization"))
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		received <- string(body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	i := NewInfluxDB(srv.URL+"/write?db=rq0r", "secret", "rq0r_request", time.Hour)
+	for _, r := range results {
+		i.Observe(sinkTest, r)
+	}
+	if err := i.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var actual []string
+	for len(received) > 0 {
+		actual = append(actual, strings.Split(<-received, "\n")...)
+	}
+	sort.Strings(actual)
+	correct := []string{
+		`rq0r_request,test=sink\ test,spec=item,status=200 duration_ms=12.000,content_length=42i 1500000000000000000`,
+		`rq0r_request,test=sink\ test,spec=search\,page\=1,status=404 duration_ms=1.500,content_length=0i 1500000000000000000`,
+		`rq0r_request,test=sink\ test,spec=search\,page\=1,status=error,error_class=connection_refused duration_ms=3.000,content_length=0i 1500000000000000000`,
+	}
+	if strings.Join(actual, "\n") != strings.Join(correct, "\n") {
+		t.Errorf("Wrong line protocol, wanted\n%s\ngot\n%s", strings.Join(correct, "\n"), strings.Join(actual, "\n"))
+	}
+}
+
+func TestInfluxDB_Error(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "database not found", http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	i := NewInfluxDB(srv.URL+"/write?db=missing", "", "rq0r_request", time.Hour)
+	i.Observe(sinkTest, results[0])
+	if err := i.Close(); err == nil {
+		t.Error("Expected an error when InfluxDB rejects the write")
+	}
+}
+
+func TestBatcher_SlowFlush(t *testing.T) {
+	release := make(chan struct{})
+	flushed := 0
+	b := newBatcher(time.Hour, 2, func(lines []string) error {
+		<-release
+		flushed += len(lines)
+		return nil
+	})
+
+	// Add must not wait for the blocked flush
+	added := make(chan struct{})
+	go func() {
+		defer close(added)
+		for i := 0; i < 100; i++ {
+			b.Add("a", "b")
+		}
+	}()
+	select {
+	case <-added:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Add blocked while flushing")
+	}
+
+	close(release)
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if b.dropped == 0 || flushed+b.dropped != 200 {
+		t.Errorf("Expected all 200 lines to be flushed or dropped, %d were flushed and %d dropped", flushed, b.dropped)
+	}
+}
@@ -0,0 +1,96 @@
+package sinks
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pbaettig/request0r/internal/app"
+	"github.com/pbaettig/request0r/internal/pkg/resultutils"
+)
+
+// maxDatagramSize keeps StatsD packets below the typical MTU
+const maxDatagramSize = 1432
+
+// StatsD sends request counters and timings to a StatsD server via UDP.
+// Points are tagged using the DogStatsD tag extension.
+type StatsD struct {
+	conn   net.Conn
+	prefix string
+	*batcher
+}
+
+// NewStatsD returns a StatsD sink sending to addr (host:port) every interval.
+// All metric names are prefixed with prefix.
+func NewStatsD(addr, prefix string, interval time.Duration) (*StatsD, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &StatsD{
+		conn:   conn,
+		prefix: prefix,
+	}
+	s.batcher = newBatcher(interval, 1000, s.send)
+	return s, nil
+}
+
+// Observe records a single result of t
+func (s *StatsD) Observe(t *app.Test, r app.WorkerResult) {
+	tags := statsdTags(t, r)
+	s.Add(
+		fmt.Sprintf("%srequests:1|c|#%s", s.prefix, tags),
+		fmt.Sprintf("%srequest_duration:%s|ms|#%s", s.prefix,
+			strconv.FormatFloat(float64(r.RequestDuration)/float64(time.Millisecond), 'f', 3, 64), tags),
+	)
+}
+
+// Close flushes all pending points and closes the connection
+func (s *StatsD) Close() error {
+	err := s.batcher.Close()
+	if cerr := s.conn.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// send packs lines into as few datagrams as possible and sends them
+func (s *StatsD) send(lines []string) error {
+	b := new(strings.Builder)
+	for _, l := range lines {
+		if b.Len() > 0 && b.Len()+1+len(l) > maxDatagramSize {
+			if _, err := s.conn.Write([]byte(b.String())); err != nil {
+				return err
+			}
+			b.Reset()
+		}
+		if b.Len() > 0 {
+			b.WriteByte('\n')
+		}
+		b.WriteString(l)
+	}
+	_, err := s.conn.Write([]byte(b.String()))
+	return err
+}
+
+func statsdTags(t *app.Test, r app.WorkerResult) string {
+	tags := []string{
+		"test:" + statsdEscape(t.ID),
+		"spec:" + statsdEscape(t.SpecName(r.Spec)),
+	}
+	if r.Error != nil {
+		tags = append(tags, "status:error", "error_class:"+resultutils.ErrorClass(r.Error))
+	} else {
+		tags = append(tags, "status:"+strconv.Itoa(r.StatusCode))
+	}
+	return strings.Join(tags, ",")
+}
+
+// statsdEscape replaces characters with a special meaning in the StatsD
+// protocol
+func statsdEscape(s string) string {
+	return strings.NewReplacer(",", "_", "|", "_", ":", "_", "#", "_", "\n", "_").Replace(s)
+}
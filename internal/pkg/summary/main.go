@@ -0,0 +1,246 @@
+package summary
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/pbaettig/request0r/internal/app"
+	"github.com/pbaettig/request0r/internal/pkg/resultutils"
+	"github.com/pbaettig/request0r/internal/pkg/statutils"
+)
+
+// Percentiles are the response duration percentiles stored in a Summary
+var Percentiles = []float64{0.5, 0.9, 0.95, 0.99}
+
+// Summary is the condensed outcome of a run that can be saved to disk
+// and compared against later runs
+type Summary struct {
+	Created time.Time     `json:"created"`
+	Tests   []TestSummary `json:"tests"`
+}
+
+// TestSummary is the condensed outcome of a single Test
+type TestSummary struct {
+	ID                string                   `json:"id"`
+	Requests          int                      `json:"requests"`
+	Errors            int                      `json:"errors"`
+	ErrorPercent      float64                  `json:"errorPercent"`
+	RequestsPerSecond float64                  `json:"requestsPerSecond"`
+	Percentiles       map[string]time.Duration `json:"percentiles"`
+	StatusCodes       map[string]int           `json:"statusCodes"`
+}
+
+// Test returns the summary of the test with the given ID
+func (s Summary) Test(id string) (TestSummary, bool) {
+	for _, t := range s.Tests {
+		if t.ID == id {
+			return t, true
+		}
+	}
+	return TestSummary{}, false
+}
+
+// New summarizes runs
+func New(runs []app.TestRun, created time.Time) Summary {
+	s := Summary{Created: created}
+	for _, run := range runs {
+		ts := TestSummary{
+			ID:                run.Test.ID,
+			Requests:          len(run.Results),
+			Errors:            len(resultutils.GetErrors(run.Results)),
+			RequestsPerSecond: statutils.SumRequestsPerSecond(run.Stats),
+			Percentiles:       make(map[string]time.Duration),
+			StatusCodes:       make(map[string]int),
+		}
+		if ts.Requests > 0 {
+			ts.ErrorPercent = float64(ts.Errors) * 100.0 / float64(ts.Requests)
+		}
+		for _, p := range Percentiles {
+			ts.Percentiles[percentileName(p)] = resultutils.GetDurationPercentile(run.Results, p)
+		}
+		for code, count := range resultutils.CountResponseStatusCodes(run.Results) {
+			ts.StatusCodes[strconv.Itoa(code)] = count
+		}
+		s.Tests = append(s.Tests, ts)
+	}
+	return s
+}
+
+// Save writes s as JSON to path
+func Save(path string, s Summary) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// Load reads a Summary previously written by Save from path
+func Load(path string) (Summary, error) {
+	var s Summary
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return s, err
+	}
+	if err := json.Unmarshal(data, &s); err != nil {
+		return s, fmt.Errorf("%s: %s", path, err)
+	}
+	return s, nil
+}
+
+// Tolerances define how much worse a run may be than its baseline
+// before it is considered a regression
+type Tolerances struct {
+	// LatencyIncreasePercent is the acceptable relative increase of
+	// every response duration percentile
+	LatencyIncreasePercent float64
+	// ErrorRateIncrease is the acceptable increase of the error rate
+	// in percentage points
+	ErrorRateIncrease float64
+	// ThroughputDecreasePercent is the acceptable relative decrease of
+	// the requests per second
+	ThroughputDecreasePercent float64
+}
+
+// Delta describes the change of a single metric between two runs
+type Delta struct {
+	Metric     string
+	Baseline   string
+	Current    string
+	Change     string
+	Regression bool
+}
+
+// Comparison holds the deltas of a test present in both runs, or notes
+// that the test is missing from one of them
+type Comparison struct {
+	ID                string
+	MissingInBaseline bool
+	MissingInCurrent  bool
+	Deltas            []Delta
+}
+
+// Regressions returns the number of deltas flagged as regression
+func (c Comparison) Regressions() int {
+	n := 0
+	for _, d := range c.Deltas {
+		if d.Regression {
+			n++
+		}
+	}
+	return n
+}
+
+// Compare aligns the tests of baseline and current by ID and computes
+// the deltas between them
+func Compare(baseline, current Summary, tol Tolerances) []Comparison {
+	var cs []Comparison
+	for _, cur := range current.Tests {
+		base, ok := baseline.Test(cur.ID)
+		if !ok {
+			cs = append(cs, Comparison{ID: cur.ID, MissingInBaseline: true})
+			continue
+		}
+		cs = append(cs, compareTest(base, cur, tol))
+	}
+	for _, base := range baseline.Tests {
+		if _, ok := current.Test(base.ID); !ok {
+			cs = append(cs, Comparison{ID: base.ID, MissingInCurrent: true})
+		}
+	}
+	return cs
+}
+
+func compareTest(base, cur TestSummary, tol Tolerances) Comparison {
+	c := Comparison{ID: cur.ID}
+
+	for _, p := range Percentiles {
+		name := percentileName(p)
+		b, a := base.Percentiles[name], cur.Percentiles[name]
+		change := relativeChange(float64(b), float64(a))
+		c.Deltas = append(c.Deltas, Delta{
+			Metric:     name,
+			Baseline:   b.String(),
+			Current:    a.String(),
+			Change:     formatPercent(change),
+			Regression: change > tol.LatencyIncreasePercent,
+		})
+	}
+
+	errorChange := cur.ErrorPercent - base.ErrorPercent
+	c.Deltas = append(c.Deltas, Delta{
+		Metric:     "error rate",
+		Baseline:   fmt.Sprintf("%.2f%%", base.ErrorPercent),
+		Current:    fmt.Sprintf("%.2f%%", cur.ErrorPercent),
+		Change:     fmt.Sprintf("%+.2fpp", errorChange),
+		Regression: errorChange > tol.ErrorRateIncrease,
+	})
+
+	rpsChange := relativeChange(base.RequestsPerSecond, cur.RequestsPerSecond)
+	c.Deltas = append(c.Deltas, Delta{
+		Metric:     "requests/second",
+		Baseline:   fmt.Sprintf("%.1f", base.RequestsPerSecond),
+		Current:    fmt.Sprintf("%.1f", cur.RequestsPerSecond),
+		Change:     formatPercent(rpsChange),
+		Regression: -rpsChange > tol.ThroughputDecreasePercent,
+	})
+
+	codes := make(map[string]bool)
+	for code := range base.StatusCodes {
+		codes[code] = true
+	}
+	for code := range cur.StatusCodes {
+		codes[code] = true
+	}
+	var sorted []string
+	for code := range codes {
+		sorted = append(sorted, code)
+	}
+	sort.Strings(sorted)
+	for _, code := range sorted {
+		b := share(base.StatusCodes[code], base.Requests)
+		a := share(cur.StatusCodes[code], cur.Requests)
+		c.Deltas = append(c.Deltas, Delta{
+			Metric:   "HTTP" + code,
+			Baseline: fmt.Sprintf("%.2f%%", b),
+			Current:  fmt.Sprintf("%.2f%%", a),
+			Change:   fmt.Sprintf("%+.2fpp", a-b),
+		})
+	}
+
+	return c
+}
+
+func percentileName(p float64) string {
+	return fmt.Sprintf("p%g", math.Round(p*1000)/10)
+}
+
+// relativeChange returns the change from b to a in percent of b
+func relativeChange(b, a float64) float64 {
+	if b == 0 {
+		if a == 0 {
+			return 0
+		}
+		return math.Inf(1)
+	}
+	return (a - b) * 100 / b
+}
+
+func formatPercent(p float64) string {
+	if math.IsInf(p, 1) {
+		return "+inf%"
+	}
+	return fmt.Sprintf("%+.1f%%", p)
+}
+
+func share(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) * 100 / float64(total)
+}
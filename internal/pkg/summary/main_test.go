@@ -0,0 +1,77 @@
+package summary
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCompare(t *testing.T) {
+	tol := Tolerances{
+		LatencyIncreasePercent:    10,
+		ErrorRateIncrease:         1,
+		ThroughputDecreasePercent: 10,
+	}
+	base := TestSummary{
+		ID:                "t",
+		Requests:          100,
+		ErrorPercent:      0.5,
+		RequestsPerSecond: 100,
+		Percentiles:       map[string]time.Duration{"p50": 10 * time.Millisecond, "p90": 20 * time.Millisecond, "p95": 30 * time.Millisecond, "p99": 40 * time.Millisecond},
+		StatusCodes:       map[string]int{"200": 100},
+	}
+
+	testTable := []struct {
+		name        string
+		modify      func(ts *TestSummary)
+		regressions []string
+	}{
+		{"unchanged", func(ts *TestSummary) {}, nil},
+		{"latency within tolerance", func(ts *TestSummary) { ts.Percentiles["p99"] = 44 * time.Millisecond }, nil},
+		{"latency regression", func(ts *TestSummary) { ts.Percentiles["p99"] = 45 * time.Millisecond }, []string{"p99"}},
+		{"error rate regression", func(ts *TestSummary) { ts.ErrorPercent = 1.6 }, []string{"error rate"}},
+		{"throughput regression", func(ts *TestSummary) { ts.RequestsPerSecond = 89 }, []string{"requests/second"}},
+		{"throughput improvement", func(ts *TestSummary) { ts.RequestsPerSecond = 200 }, nil},
+	}
+
+	for _, test := range testTable {
+		cur := base
+		cur.Percentiles = make(map[string]time.Duration)
+		for k, v := range base.Percentiles {
+			cur.Percentiles[k] = v
+		}
+		test.modify(&cur)
+
+		cs := Compare(Summary{Tests: []TestSummary{base}}, Summary{Tests: []TestSummary{cur}}, tol)
+		if len(cs) != 1 {
+			t.Fatalf("%s: wanted 1 comparison, got %d", test.name, len(cs))
+		}
+		var regressions []string
+		for _, d := range cs[0].Deltas {
+			if d.Regression {
+				regressions = append(regressions, d.Metric)
+			}
+		}
+		if len(regressions) != len(test.regressions) || (len(regressions) > 0 && regressions[0] != test.regressions[0]) {
+			t.Errorf("%s: wanted regressions %v, got %v", test.name, test.regressions, regressions)
+		}
+	}
+}
+
+func TestCompare_MissingTests(t *testing.T) {
+	baseline := Summary{Tests: []TestSummary{{ID: "old"}, {ID: "both"}}}
+	current := Summary{Tests: []TestSummary{{ID: "both"}, {ID: "new"}}}
+
+	cs := Compare(baseline, current, Tolerances{})
+	if len(cs) != 3 {
+		t.Fatalf("Wanted 3 comparisons, got %d", len(cs))
+	}
+	if cs[0].ID != "both" || cs[0].MissingInBaseline || cs[0].MissingInCurrent {
+		t.Errorf("Wrong comparison for test present in both runs: %+v", cs[0])
+	}
+	if cs[1].ID != "new" || !cs[1].MissingInBaseline {
+		t.Errorf("Test \"new\" should be missing in the baseline: %+v", cs[1])
+	}
+	if cs[2].ID != "old" || !cs[2].MissingInCurrent {
+		t.Errorf("Test \"old\" should be missing in the current run: %+v", cs[2])
+	}
+}
@@ -0,0 +1,205 @@
+package randurl
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"sort"
+	"sync"
+)
+
+// ErrFeederExhausted is returned by Feeder.Next once all rows have been
+// used and the Feeder is not configured to wrap around
+var ErrFeederExhausted = errors.New("feeder exhausted")
+
+// FeederMode determines in which order a Feeder hands out its rows
+type FeederMode string
+
+const (
+	// SequentialFeeder hands out the rows in the order they were read
+	SequentialFeeder FeederMode = "sequential"
+	// RandomFeeder hands out a random row every time, it never runs out of rows
+	RandomFeeder FeederMode = "random"
+	// UniqueFeeder hands out every row exactly once in random order
+	UniqueFeeder FeederMode = "unique"
+)
+
+// Row is a single record of a Feeder, mapping column names to values
+type Row map[string]string
+
+// Feeder hands out rows read from a data file. It is safe for concurrent use.
+type Feeder struct {
+	Name    string
+	Mode    FeederMode
+	Wrap    bool
+	Columns []string
+
+	mu    sync.Mutex
+	rows  []Row
+	order []int
+	next  int
+}
+
+// NewFeeder returns a Feeder handing out rows according to mode. If wrap
+// is true sequential and unique Feeders start over once all rows have been
+// used, otherwise they return ErrFeederExhausted.
+func NewFeeder(name string, columns []string, rows []Row, mode FeederMode, wrap bool) (*Feeder, error) {
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("feeder %s has no rows", name)
+	}
+	switch mode {
+	case SequentialFeeder, RandomFeeder, UniqueFeeder:
+	default:
+		return nil, fmt.Errorf("feeder %s has unknown mode %s", name, mode)
+	}
+
+	f := &Feeder{
+		Name:    name,
+		Mode:    mode,
+		Wrap:    wrap,
+		Columns: columns,
+		rows:    rows,
+	}
+	return f, nil
+}
+
+// HasColumn returns true if the rows of f have a column called name
+func (f *Feeder) HasColumn(name string) bool {
+	for _, c := range f.Columns {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Len returns the number of rows of f
+func (f *Feeder) Len() int {
+	return len(f.rows)
+}
+
+// Next returns the next row according to the Feeder's mode
+func (f *Feeder) Next() (Row, error) {
+	return f.NextRand(globalRand)
+}
+
+// NextRand is like Next but uses r to pick rows in random mode and to
+// shuffle the rows of unique Feeders, which happens on first use and every
+// time they start over
+func (f *Feeder) NextRand(r *rand.Rand) (Row, error) {
+	if f.Mode == RandomFeeder {
+		return f.rows[r.Intn(len(f.rows))], nil
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.next == len(f.rows) {
+		if !f.Wrap {
+			return nil, ErrFeederExhausted
+		}
+		f.next = 0
+		f.order = nil
+	}
+
+	i := f.next
+	if f.Mode == UniqueFeeder {
+		if f.order == nil {
+			f.order = r.Perm(len(f.rows))
+		}
+		i = f.order[i]
+	}
+	f.next++
+	return f.rows[i], nil
+}
+
+// ReadCSV reads rows from CSV data, the first record contains the
+// column names
+func ReadCSV(r io.Reader) ([]string, []Row, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil, errors.New("missing header")
+	}
+
+	columns := records[0]
+	var rows []Row
+	for _, record := range records[1:] {
+		row := make(Row, len(columns))
+		for i, c := range columns {
+			row[c] = record[i]
+		}
+		rows = append(rows, row)
+	}
+	return columns, rows, nil
+}
+
+// ReadJSONL reads rows from JSON Lines data, every line has to contain
+// a JSON object. The columns are the keys of the first object.
+func ReadJSONL(r io.Reader) ([]string, []Row, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var columns []string
+	var rows []Row
+	for n, line := range bytes.Split(data, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		d := json.NewDecoder(bytes.NewReader(line))
+		d.UseNumber()
+		var object map[string]interface{}
+		if err := d.Decode(&object); err != nil {
+			return nil, nil, fmt.Errorf("line %d: %s", n+1, err)
+		}
+
+		row := make(Row, len(object))
+		for k, v := range object {
+			switch v.(type) {
+			case string:
+				row[k] = v.(string)
+			case nil:
+				row[k] = ""
+			case map[string]interface{}, []interface{}:
+				b, _ := json.Marshal(v)
+				row[k] = string(b)
+			default:
+				row[k] = fmt.Sprint(v)
+			}
+		}
+		if columns == nil {
+			for k := range object {
+				columns = append(columns, k)
+			}
+			sort.Strings(columns)
+		}
+		rows = append(rows, row)
+	}
+	return columns, rows, nil
+}
+
+// FeederComponent uses the value of Column of a row handed out by Feeder.
+// All FeederComponents of an URLSpec sharing the same Feeder use the same
+// row for a generated URL.
+type FeederComponent struct {
+	Feeder *Feeder
+	Column string
+}
+
+func (f FeederComponent) String() string {
+	row, err := f.Feeder.Next()
+	if err != nil {
+		return ""
+	}
+	return row[f.Column]
+}
@@ -0,0 +1,154 @@
+package randurl
+
+import (
+	"math/rand"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func newTestFeeder(t *testing.T, mode FeederMode, wrap bool) *Feeder {
+	columns, rows, err := ReadCSV(strings.NewReader("id,name\n1,alice\n2,bob\n3,carol\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := NewFeeder("users", columns, rows, mode, wrap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func nextIDs(t *testing.T, f *Feeder, n int) []string {
+	var ids []string
+	for i := 0; i < n; i++ {
+		row, err := f.Next()
+		if err != nil {
+			t.Fatalf("Row %d: %s", i, err)
+		}
+		ids = append(ids, row["id"])
+	}
+	return ids
+}
+
+func TestFeeder_Sequential(t *testing.T) {
+	f := newTestFeeder(t, SequentialFeeder, true)
+	if ids := strings.Join(nextIDs(t, f, 7), ","); ids != "1,2,3,1,2,3,1" {
+		t.Errorf("Sequential feeder returned rows %s, wanted 1,2,3,1,2,3,1", ids)
+	}
+
+	f = newTestFeeder(t, SequentialFeeder, false)
+	nextIDs(t, f, 3)
+	if _, err := f.Next(); err != ErrFeederExhausted {
+		t.Errorf("Expected ErrFeederExhausted, got %v", err)
+	}
+}
+
+func TestFeeder_Unique(t *testing.T) {
+	f := newTestFeeder(t, UniqueFeeder, false)
+	ids := nextIDs(t, f, 3)
+	sort.Strings(ids)
+	if strings.Join(ids, ",") != "1,2,3" {
+		t.Errorf("Unique feeder returned rows %v, wanted every row exactly once", ids)
+	}
+	if _, err := f.Next(); err != ErrFeederExhausted {
+		t.Errorf("Expected ErrFeederExhausted, got %v", err)
+	}
+
+	f = newTestFeeder(t, UniqueFeeder, true)
+	ids = nextIDs(t, f, 6)
+	sort.Strings(ids)
+	if strings.Join(ids, ",") != "1,1,2,2,3,3" {
+		t.Errorf("Wrapping unique feeder returned rows %v, wanted every row exactly twice", ids)
+	}
+}
+
+func TestFeeder_UniqueSeed(t *testing.T) {
+	order := func(seed int64) string {
+		f := newTestFeeder(t, UniqueFeeder, true)
+		r := rand.New(rand.NewSource(seed))
+		var ids []string
+		for i := 0; i < 6; i++ {
+			row, err := f.NextRand(r)
+			if err != nil {
+				t.Fatalf("Row %d: %s", i, err)
+			}
+			ids = append(ids, row["id"])
+		}
+		return strings.Join(ids, ",")
+	}
+
+	// Rows are shuffled using the given source, so they are handed out in
+	// the same order for the same seed
+	for seed := int64(1); seed <= 10; seed++ {
+		if first, second := order(seed), order(seed); first != second {
+			t.Errorf("Seed %d: unique feeder returned rows %s, then %s", seed, first, second)
+		}
+	}
+}
+
+func TestFeeder_Random(t *testing.T) {
+	f := newTestFeeder(t, RandomFeeder, false)
+	for _, id := range nextIDs(t, f, 50) {
+		if id != "1" && id != "2" && id != "3" {
+			t.Errorf("Random feeder returned unknown row %s", id)
+		}
+	}
+}
+
+func TestReadJSONL(t *testing.T) {
+	columns, rows, err := ReadJSONL(strings.NewReader(`{"id": 12345678901, "name": "alice", "tags": ["a"]}
+
+{"id": 2, "name": null}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(columns, ",") != "id,name,tags" {
+		t.Errorf("Wrong columns %v", columns)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("Wanted 2 rows, got %d", len(rows))
+	}
+	if rows[0]["id"] != "12345678901" || rows[0]["name"] != "alice" || rows[0]["tags"] != `["a"]` {
+		t.Errorf("Wrong first row %v", rows[0])
+	}
+	if rows[1]["id"] != "2" || rows[1]["name"] != "" {
+		t.Errorf("Wrong second row %v", rows[1])
+	}
+
+	if _, _, err := ReadJSONL(strings.NewReader("{\"id\": 1}\nnot json\n")); err == nil {
+		t.Error("Expected an error for invalid JSON")
+	}
+}
+
+func TestURLSpec_GenerateSharesFeederRows(t *testing.T) {
+	f := newTestFeeder(t, SequentialFeeder, false)
+	spec := URLSpec{
+		Scheme: "https",
+		Host:   "users.local",
+		Components: []PathComponent{
+			FeederComponent{Feeder: f, Column: "id"},
+			StringComponent("name"),
+			FeederComponent{Feeder: f, Column: "name"},
+		},
+	}
+
+	correct := []string{
+		"https://users.local/1/name/alice",
+		"https://users.local/2/name/bob",
+		"https://users.local/3/name/carol",
+	}
+	for _, c := range correct {
+		actual, err := spec.Generate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if actual != c {
+			t.Errorf("Generated URL %s, wanted %s", actual, c)
+		}
+	}
+	if _, err := spec.Generate(); err != ErrFeederExhausted {
+		t.Errorf("Expected ErrFeederExhausted, got %v", err)
+	}
+}
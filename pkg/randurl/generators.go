@@ -0,0 +1,168 @@
+package randurl
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// UUIDComponent generates random UUIDs of version 4 or 7 (time-ordered)
+type UUIDComponent struct {
+	Version int
+}
+
+// Validate returns an error if the version is not supported
+func (u UUIDComponent) Validate() error {
+	if u.Version != 4 && u.Version != 7 {
+		return fmt.Errorf("unsupported UUID version %d, use 4 or 7", u.Version)
+	}
+	return nil
+}
+
+func (u UUIDComponent) String() string {
+	return u.Random(globalRand)
+}
+
+func (u UUIDComponent) Random(r *rand.Rand) string {
+	var b [16]byte
+	randomBytes(r, b[:])
+
+	if u.Version == 7 {
+		// The first 48 bits contain the milliseconds since the epoch
+		var ts [8]byte
+		binary.BigEndian.PutUint64(ts[:], uint64(time.Now().UnixNano()/int64(time.Millisecond)))
+		copy(b[:6], ts[2:])
+	}
+	b[6] = (b[6] & 0x0f) | byte(u.Version<<4)
+	b[8] = (b[8] & 0x3f) | 0x80 // RFC 4122 variant
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// Named formats supported by TimestampComponent in addition to Go time layouts
+const (
+	RFC3339Format    = "rfc3339"
+	DateFormat       = "date"
+	UnixFormat       = "unix"
+	UnixMillisFormat = "unixMillis"
+)
+
+// TimestampComponent generates a timestamp at a random offset between
+// MinOffset and MaxOffset relative to the time the URL is generated.
+// Format is either one of the named formats or a Go time layout,
+// it defaults to ISO-8601 (RFC 3339). Times are in UTC.
+type TimestampComponent struct {
+	Format    string
+	MinOffset time.Duration
+	MaxOffset time.Duration
+}
+
+// Validate returns an error if the offset range is empty
+func (ts TimestampComponent) Validate() error {
+	if ts.MaxOffset < ts.MinOffset {
+		return fmt.Errorf("maxOffset (%s) must not be less than minOffset (%s)", ts.MaxOffset, ts.MinOffset)
+	}
+	return nil
+}
+
+func (ts TimestampComponent) String() string {
+	return ts.Random(globalRand)
+}
+
+func (ts TimestampComponent) Random(r *rand.Rand) string {
+	offset := ts.MinOffset
+	if ts.MaxOffset > ts.MinOffset {
+		offset += time.Duration(r.Int63n(int64(ts.MaxOffset - ts.MinOffset)))
+	}
+	t := time.Now().Add(offset).UTC()
+
+	switch ts.Format {
+	case "", RFC3339Format:
+		return t.Format(time.RFC3339)
+	case DateFormat:
+		return t.Format("2006-01-02")
+	case UnixFormat:
+		return strconv.FormatInt(t.Unix(), 10)
+	case UnixMillisFormat:
+		return strconv.FormatInt(t.UnixNano()/int64(time.Millisecond), 10)
+	default:
+		return t.Format(ts.Format)
+	}
+}
+
+// SequenceComponent generates monotonically increasing integers starting
+// at Start and incrementing by Step. Copies of a SequenceComponent share
+// the same counter, so it can be used by concurrent workers.
+type SequenceComponent struct {
+	Start   int64
+	Step    int64
+	counter *int64
+}
+
+// NewSequenceComponent returns a SequenceComponent with a new counter
+func NewSequenceComponent(start, step int64) SequenceComponent {
+	return SequenceComponent{
+		Start:   start,
+		Step:    step,
+		counter: new(int64),
+	}
+}
+
+func (s SequenceComponent) String() string {
+	n := atomic.AddInt64(s.counter, 1) - 1
+	return strconv.FormatInt(s.Start+n*s.Step, 10)
+}
+
+// Encodings supported by RandomBytesComponent
+const (
+	HexEncoding    = "hex"
+	Base64Encoding = "base64"
+)
+
+// RandomBytesComponent generates Length random bytes, encoded either as
+// hex or as URL-safe base64 without padding
+type RandomBytesComponent struct {
+	Length   int
+	Encoding string
+}
+
+// Validate returns an error if the length or encoding are invalid
+func (rb RandomBytesComponent) Validate() error {
+	if rb.Length <= 0 {
+		return fmt.Errorf("length must be greater than 0, got %d", rb.Length)
+	}
+	if rb.Encoding != HexEncoding && rb.Encoding != Base64Encoding {
+		return fmt.Errorf("unknown encoding %s", rb.Encoding)
+	}
+	return nil
+}
+
+func (rb RandomBytesComponent) String() string {
+	return rb.Random(globalRand)
+}
+
+func (rb RandomBytesComponent) Random(r *rand.Rand) string {
+	b := make([]byte, rb.Length)
+	randomBytes(r, b)
+	if rb.Encoding == Base64Encoding {
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+	return hex.EncodeToString(b)
+}
+
+// randomBytes fills b with random bytes from r. Unlike r.Read it keeps no
+// state in r, so it can be used with globalRand concurrently.
+func randomBytes(r *rand.Rand, b []byte) {
+	for i := 0; i < len(b); i += 4 {
+		n := r.Uint32()
+		for j := i; j < i+4 && j < len(b); j++ {
+			b[j] = byte(n)
+			n >>= 8
+		}
+	}
+}
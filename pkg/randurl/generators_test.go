@@ -0,0 +1,128 @@
+package randurl
+
+import (
+	"regexp"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestUUIDComponent_String(t *testing.T) {
+	tests := []struct {
+		version int
+		re      *regexp.Regexp
+	}{
+		{4, regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)},
+		{7, regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)},
+	}
+	for _, tt := range tests {
+		u := UUIDComponent{Version: tt.version}
+		for i := 0; i < 100; i++ {
+			if s := u.String(); !tt.re.MatchString(s) {
+				t.Errorf("%s is not a valid version %d UUID", s, tt.version)
+			}
+		}
+	}
+
+	// Version 7 UUIDs start with the current time in milliseconds
+	before := time.Now().UnixNano() / int64(time.Millisecond)
+	s := UUIDComponent{Version: 7}.String()
+	after := time.Now().UnixNano() / int64(time.Millisecond)
+	ms, _ := strconv.ParseInt(s[0:8]+s[9:13], 16, 64)
+	if ms < before || ms > after {
+		t.Errorf("UUID %s has timestamp %d, expected between %d and %d", s, ms, before, after)
+	}
+
+	if err := (UUIDComponent{Version: 1}).Validate(); err == nil {
+		t.Error("Expected an error for version 1")
+	}
+}
+
+func TestTimestampComponent_String(t *testing.T) {
+	tests := []struct {
+		format string
+		re     *regexp.Regexp
+	}{
+		{"", regexp.MustCompile(`^\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}Z$`)},
+		{DateFormat, regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)},
+		{UnixFormat, regexp.MustCompile(`^\d{10}$`)},
+		{UnixMillisFormat, regexp.MustCompile(`^\d{13}$`)},
+		{"2006/01", regexp.MustCompile(`^\d{4}/\d{2}$`)},
+	}
+	for _, tt := range tests {
+		ts := TimestampComponent{Format: tt.format}
+		if s := ts.String(); !tt.re.MatchString(s) {
+			t.Errorf("Format %q: %s does not match %s", tt.format, s, tt.re)
+		}
+	}
+
+	ts := TimestampComponent{Format: UnixFormat, MinOffset: -48 * time.Hour, MaxOffset: -24 * time.Hour}
+	for i := 0; i < 100; i++ {
+		now := time.Now().Unix()
+		n, _ := strconv.ParseInt(ts.String(), 10, 64)
+		if n < now-48*3600-1 || n > now-24*3600 {
+			t.Errorf("Timestamp %d is outside of the offset range", n)
+		}
+	}
+
+	if err := (TimestampComponent{MinOffset: time.Hour}).Validate(); err == nil {
+		t.Error("Expected an error for maxOffset < minOffset")
+	}
+}
+
+func TestSequenceComponent_String(t *testing.T) {
+	s := NewSequenceComponent(10, 5)
+	for i, want := range []string{"10", "15", "20"} {
+		if got := s.String(); got != want {
+			t.Errorf("Value %d: wanted %s, got %s", i, want, got)
+		}
+	}
+
+	// Copies share the counter, every value is handed out exactly once
+	s = NewSequenceComponent(0, 1)
+	var mu sync.Mutex
+	seen := make(map[string]bool)
+	var wg sync.WaitGroup
+	for w := 0; w < 10; w++ {
+		wg.Add(1)
+		go func(c SequenceComponent) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				v := c.String()
+				mu.Lock()
+				if seen[v] {
+					t.Errorf("Value %s was generated twice", v)
+				}
+				seen[v] = true
+				mu.Unlock()
+			}
+		}(s)
+	}
+	wg.Wait()
+	if len(seen) != 1000 {
+		t.Errorf("Expected 1000 distinct values, got %d", len(seen))
+	}
+}
+
+func TestRandomBytesComponent_String(t *testing.T) {
+	tests := []struct {
+		component RandomBytesComponent
+		re        *regexp.Regexp
+	}{
+		{RandomBytesComponent{Length: 8, Encoding: HexEncoding}, regexp.MustCompile(`^[0-9a-f]{16}$`)},
+		{RandomBytesComponent{Length: 12, Encoding: Base64Encoding}, regexp.MustCompile(`^[A-Za-z0-9_-]{16}$`)},
+		{RandomBytesComponent{Length: 10, Encoding: Base64Encoding}, regexp.MustCompile(`^[A-Za-z0-9_-]{14}$`)},
+	}
+	for _, tt := range tests {
+		for i := 0; i < 100; i++ {
+			if s := tt.component.String(); !tt.re.MatchString(s) {
+				t.Errorf("%+v: %s does not match %s", tt.component, s, tt.re)
+			}
+		}
+	}
+
+	if err := (RandomBytesComponent{Length: 0, Encoding: HexEncoding}).Validate(); err == nil {
+		t.Error("Expected an error for length 0")
+	}
+}
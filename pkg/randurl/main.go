@@ -2,6 +2,7 @@ package randurl
 
 import (
 	"fmt"
+	"math"
 	"math/rand"
 	"regexp"
 	"strconv"
@@ -12,18 +13,68 @@ type PathComponent interface {
 	String() string
 }
 
+// RandomComponent is a PathComponent whose values are drawn from a source
+// of randomness. Random generates a value using r, String uses the shared
+// source of the top-level math/rand functions.
+type RandomComponent interface {
+	PathComponent
+	Random(r *rand.Rand) string
+}
+
 type URLSpec struct {
+	// Name identifies the URLSpec in reports
+	Name         string
 	Scheme, Host string
 	Components   []PathComponent
+	// Weight is the relative share of requests made to this URLSpec
+	// in a weighted traffic mix
+	Weight float64
 }
 
 func (u URLSpec) String() string {
+	s, _ := u.Generate()
+	return s
+}
+
+// Generate returns a new URL. Components sharing a Feeder use the same
+// row, if a Feeder is exhausted ErrFeederExhausted is returned.
+func (u URLSpec) Generate() (string, error) {
+	return u.GenerateRand(globalRand)
+}
+
+// GenerateRand is like Generate but draws all random values from r. Given
+// the same r the same URLs are generated, unless the URLSpec uses
+// sequential or unique Feeders, which are shared by all workers.
+func (u URLSpec) GenerateRand(r *rand.Rand) (string, error) {
+	var rows map[*Feeder]Row
+
 	b := strings.Builder{}
 	b.WriteString(fmt.Sprintf("%s://%s", u.Scheme, u.Host))
 	for _, s := range u.Components {
-		b.WriteString(fmt.Sprintf("/%s", s.String()))
+		fc, ok := s.(FeederComponent)
+		if !ok {
+			if rc, ok := s.(RandomComponent); ok {
+				b.WriteString(fmt.Sprintf("/%s", rc.Random(r)))
+			} else {
+				b.WriteString(fmt.Sprintf("/%s", s.String()))
+			}
+			continue
+		}
+
+		if rows == nil {
+			rows = make(map[*Feeder]Row)
+		}
+		row, ok := rows[fc.Feeder]
+		if !ok {
+			var err error
+			if row, err = fc.Feeder.NextRand(r); err != nil {
+				return b.String(), err
+			}
+			rows[fc.Feeder] = row
+		}
+		b.WriteString(fmt.Sprintf("/%s", row[fc.Column]))
 	}
-	return b.String()
+	return b.String(), nil
 }
 
 type StringComponent string
@@ -44,30 +95,200 @@ type RandomHTTPStatusComponent struct {
 }
 
 func (hs RandomHTTPStatusComponent) String() string {
+	return hs.Random(globalRand)
+}
+
+func (hs RandomHTTPStatusComponent) Random(r *rand.Rand) string {
 	var vc []int
 	// Build a list of all valid codes that were requested in `Ranges`
-	for _, r := range hs.Ranges {
+	for _, rng := range hs.Ranges {
 		for _, v := range validStatuses {
-			if r/100 == v/100 {
+			if rng/100 == v/100 {
 				vc = append(vc, v)
 			}
 		}
 
 	}
-	return strconv.Itoa(vc[rand.Intn(len(vc))])
+	return strconv.Itoa(vc[r.Intn(len(vc))])
 
 }
 
+// globalSource delegates to the shared source of the top-level math/rand
+// functions, it allows using that source where a *rand.Rand is required.
+// globalRand is safe for concurrent use except for its Read method.
+type globalSource struct{}
+
+func (globalSource) Int63() int64    { return rand.Int63() }
+func (globalSource) Seed(seed int64) { rand.Seed(seed) }
+
+var globalRand = rand.New(globalSource{})
+
+// Distribution determines how the values of a RandomIntegerComponent
+// are spread across its range
+type Distribution string
+
+const (
+	UniformDistribution     Distribution = "uniform"
+	ZipfDistribution        Distribution = "zipf"
+	NormalDistribution      Distribution = "normal"
+	ExponentialDistribution Distribution = "exponential"
+)
+
+// maxResamples limits how often a value outside of [Min, Max) is drawn
+// again before it is clamped
+const maxResamples = 100
+
+// RandomIntegerComponent generates integers in [Min, Max). By default they
+// are distributed uniformly, Distribution selects a different distribution:
+//
+// zipf: Min is the most frequent value, followed by Min+1 and so on.
+// S (> 1, default 1.1) and V (>= 1, default 1) control the skew.
+//
+// normal: Values are centered around Mean (default the middle of the
+// range) with a standard deviation of StdDev (default a sixth of the range).
+//
+// exponential: Values decay exponentially from Min with Rate
+// (default 10 / (Max - Min), i.e. an average of a tenth of the range).
 type RandomIntegerComponent struct {
 	Min int
 	Max int
+
+	Distribution Distribution
+	S, V         float64
+	Mean         *float64
+	StdDev       float64
+	Rate         float64
+}
+
+// Validate returns an error if i cannot generate any values
+func (i RandomIntegerComponent) Validate() error {
+	if i.Max <= i.Min {
+		return fmt.Errorf("max (%d) needs to be greater than min (%d)", i.Max, i.Min)
+	}
+
+	switch i.Distribution {
+	case "", UniformDistribution, NormalDistribution, ExponentialDistribution:
+	case ZipfDistribution:
+		if i.S != 0 && i.S <= 1 {
+			return fmt.Errorf("zipf distribution requires s > 1, got %g", i.S)
+		}
+		if i.V != 0 && i.V < 1 {
+			return fmt.Errorf("zipf distribution requires v >= 1, got %g", i.V)
+		}
+	default:
+		return fmt.Errorf("unknown distribution %s", i.Distribution)
+	}
+
+	if i.StdDev < 0 {
+		return fmt.Errorf("stdDev must not be negative, got %g", i.StdDev)
+	}
+	if i.Rate < 0 {
+		return fmt.Errorf("rate must not be negative, got %g", i.Rate)
+	}
+	return nil
 }
 
 func (i RandomIntegerComponent) String() string {
-	n := rand.Intn(i.Max-i.Min) + i.Min
+	return i.Random(globalRand)
+}
+
+func (i RandomIntegerComponent) Random(r *rand.Rand) string {
+	var n int
+	switch i.Distribution {
+	case ZipfDistribution:
+		n = i.zipf(r)
+	case NormalDistribution:
+		n = i.normal(r)
+	case ExponentialDistribution:
+		n = i.exponential(r)
+	default:
+		n = r.Intn(i.Max-i.Min) + i.Min
+	}
 	return strconv.Itoa(n)
 }
 
+func (i RandomIntegerComponent) zipf(r *rand.Rand) int {
+	s, v := i.S, i.V
+	if s == 0 {
+		s = 1.1
+	}
+	if v == 0 {
+		v = 1
+	}
+	z := rand.NewZipf(r, s, v, uint64(i.Max-i.Min-1))
+	return i.Min + int(z.Uint64())
+}
+
+func (i RandomIntegerComponent) normal(r *rand.Rand) int {
+	mean, stdDev := float64(i.Min)+float64(i.Max-i.Min)/2, i.StdDev
+	if i.Mean != nil {
+		mean = *i.Mean
+	}
+	if stdDev == 0 {
+		stdDev = float64(i.Max-i.Min) / 6
+	}
+	return i.sample(func() float64 {
+		return r.NormFloat64()*stdDev + mean
+	})
+}
+
+func (i RandomIntegerComponent) exponential(r *rand.Rand) int {
+	rate := i.Rate
+	if rate == 0 {
+		rate = 10 / float64(i.Max-i.Min)
+	}
+	return i.sample(func() float64 {
+		return float64(i.Min) + r.ExpFloat64()/rate
+	})
+}
+
+// sample draws values from f until one falls into [Min, Max), giving up
+// and clamping the value after maxResamples attempts
+func (i RandomIntegerComponent) sample(f func() float64) int {
+	var n int
+	for attempt := 0; attempt < maxResamples; attempt++ {
+		n = int(math.Floor(f()))
+		if n >= i.Min && n < i.Max {
+			return n
+		}
+	}
+	if n < i.Min {
+		return i.Min
+	}
+	return i.Max - 1
+}
+
+// ChoiceComponent picks one of Values. If Weights is set it has to contain
+// one weight per value, defining the relative probability of each value
+type ChoiceComponent struct {
+	Values  []string
+	Weights []float64
+}
+
+func (c ChoiceComponent) String() string {
+	return c.Random(globalRand)
+}
+
+func (c ChoiceComponent) Random(r *rand.Rand) string {
+	if len(c.Weights) == 0 {
+		return c.Values[r.Intn(len(c.Values))]
+	}
+
+	total := 0.0
+	for _, w := range c.Weights {
+		total += w
+	}
+	n := r.Float64() * total
+	for i, w := range c.Weights {
+		if n < w {
+			return c.Values[i]
+		}
+		n -= w
+	}
+	// Only reachable due to floating point inaccuracies
+	return c.Values[len(c.Values)-1]
+}
+
 const (
 	LowercaseAlphabetChars = "abcdefghijklmnopqrstuvwxyz"
 	UppercaseAlphabetChars = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
@@ -76,52 +297,156 @@ const (
 	PunctuationChars       = ".,-_+!()[]{}*"
 )
 
+// BuiltinCharClasses are the character classes that can be referred to by
+// name in the placeholders of a RandomStringComponent's Format
+var BuiltinCharClasses = map[string]string{
+	"lower":  LowercaseAlphabetChars,
+	"upper":  UppercaseAlphabetChars,
+	"alpha":  AlphabetChars,
+	"digits": DigitChars,
+	"alnum":  AlphabetChars + DigitChars,
+	"punct":  PunctuationChars,
+}
+
+// RandomStringComponent generates strings according to Format. Every
+// placeholder in Format is replaced by random characters, a placeholder
+// has the form %[{class}][min,max]s:
+//   - %s uses Chars with a length between MinLength and MaxLength
+//   - %4,8s uses Chars with a length between 4 and 8
+//   - %{digits}s and %{digits}4,8s use the characters of the named class,
+//     which is looked up in Classes first and BuiltinCharClasses second
+//
+// Lengths are inclusive and %% produces a literal %.
 type RandomStringComponent struct {
-	Chars  []rune
-	Format string
+	Chars     []rune
+	Format    string
+	MinLength int
+	MaxLength int
+	Classes   map[string][]rune
 }
 
-func makeRandomString(minLength, maxLength int, chars []rune) string {
-	var targetLength int
-	if maxLength == minLength {
-		targetLength = maxLength
-	} else {
-		targetLength = rand.Intn(maxLength-minLength) + minLength
+// formatPart is either a literal string or a placeholder of a Format
+type formatPart struct {
+	literal  string
+	chars    []rune
+	min, max int
+	// defaultLength is true if the placeholder uses MinLength and MaxLength
+	defaultLength bool
+}
+
+var placeholderRegex = regexp.MustCompile(`^%(?:\{(\w+)\})?(?:(\d+),(\d+))?s`)
+
+// parse splits the Format of r into literals and placeholders and returns
+// an error if they are inconsistent with the other fields of r
+func (r RandomStringComponent) parse() ([]formatPart, error) {
+	format := r.Format
+	if format == "" {
+		format = "%s"
 	}
 
+	var parts []formatPart
+	for len(format) > 0 {
+		i := strings.IndexByte(format, '%')
+		if i < 0 {
+			parts = append(parts, formatPart{literal: format})
+			break
+		}
+		if i > 0 {
+			parts = append(parts, formatPart{literal: format[:i]})
+			format = format[i:]
+		}
+		if strings.HasPrefix(format, "%%") {
+			parts = append(parts, formatPart{literal: "%"})
+			format = format[2:]
+			continue
+		}
+
+		m := placeholderRegex.FindStringSubmatch(format)
+		if m == nil {
+			return nil, fmt.Errorf("invalid placeholder at %q", format)
+		}
+		format = format[len(m[0]):]
+
+		p := formatPart{chars: r.Chars, min: r.MinLength, max: r.MaxLength}
+		if class := m[1]; class != "" {
+			if chars, ok := r.Classes[class]; ok {
+				p.chars = chars
+			} else if chars, ok := BuiltinCharClasses[class]; ok {
+				p.chars = []rune(chars)
+			} else {
+				return nil, fmt.Errorf("unknown character class %s in %s", class, m[0])
+			}
+		}
+		if m[2] != "" {
+			p.min, _ = strconv.Atoi(m[2])
+			p.max, _ = strconv.Atoi(m[3])
+		} else {
+			p.defaultLength = true
+		}
+		if len(p.chars) == 0 {
+			return nil, fmt.Errorf("no characters for %s, set chars or use a character class", m[0])
+		}
+		if p.min > p.max {
+			return nil, fmt.Errorf("min length %d is greater than max length %d in %s", p.min, p.max, m[0])
+		}
+		if p.max == 0 {
+			return nil, fmt.Errorf("no length for %s, set maxLength or use %%min,maxs", m[0])
+		}
+		parts = append(parts, p)
+	}
+	return parts, nil
+}
+
+// Validate returns an error if the Format is invalid, a placeholder has no
+// characters or lengths to use or MinLength and MaxLength are set but not
+// used by any placeholder
+func (r RandomStringComponent) Validate() error {
+	if r.MinLength < 0 || r.MaxLength < 0 {
+		return fmt.Errorf("lengths must not be negative")
+	}
+	parts, err := r.parse()
+	if err != nil {
+		return err
+	}
+	if r.MinLength == 0 && r.MaxLength == 0 {
+		return nil
+	}
+	for _, p := range parts {
+		if p.defaultLength {
+			return nil
+		}
+	}
+	return fmt.Errorf("minLength and maxLength are set but every placeholder in format %q has its own lengths", r.Format)
+}
+
+func makeRandomString(r *rand.Rand, minLength, maxLength int, chars []rune) string {
+	targetLength := minLength + r.Intn(maxLength-minLength+1)
+
 	randomChars := make([]rune, targetLength)
 	for i := 0; i < targetLength; i++ {
-		randomChars[i] = chars[rand.Intn(len(chars))]
+		randomChars[i] = chars[r.Intn(len(chars))]
 	}
 
 	return string(randomChars)
 }
 
 func (r RandomStringComponent) String() string {
-	// Set default format string if none was provided
-	if r.Format == "" {
-		r.Format = "%s"
-	}
-
-	// Regexp to identify the min,max values, if provided to the format spec
-	formatSpecRegex := regexp.MustCompile(`%(?P<min>\d+),(?P<max>\d+)s`)
+	return r.Random(globalRand)
+}
 
-	// Make a slice containing all the format specs provided in the format string
-	formatSpecs := formatSpecRegex.FindAllString(r.Format, -1)
+func (r RandomStringComponent) Random(rnd *rand.Rand) string {
+	parts, err := r.parse()
+	if err != nil {
+		return ""
+	}
 
-	args := make([]interface{}, len(formatSpecs))
-	for i, f := range formatSpecs {
-		matches := formatSpecRegex.FindStringSubmatch(f)
-		if matches != nil {
-			min, _ := strconv.Atoi(matches[1])
-			max, _ := strconv.Atoi(matches[2])
-			args[i] = makeRandomString(min, max, r.Chars)
+	b := strings.Builder{}
+	for _, p := range parts {
+		if p.chars == nil {
+			b.WriteString(p.literal)
+			continue
 		}
-
+		b.WriteString(makeRandomString(rnd, p.min, p.max, p.chars))
 	}
-
-	// Replace custom format specs with %s to make it compatible
-	// with golang format string
-	return fmt.Sprintf(formatSpecRegex.ReplaceAllString(r.Format, "%s"), args...)
-
+	return b.String()
 }
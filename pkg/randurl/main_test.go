@@ -1,8 +1,11 @@
 package randurl
 
 import (
+	"math"
 	"math/rand"
+	"reflect"
 	"regexp"
+	"strconv"
 	"testing"
 	"time"
 )
@@ -19,6 +22,11 @@ func TestRandomStringComponent_String(t *testing.T) {
 		{RandomStringComponent{Format: "%1,8s", Chars: []rune("ABCDEFGHIJKLMNOPQRSTUVWYZ")}, regexp.MustCompile(`^[ABCDEFGHIJKLMNOPQRSTUVWYZ]{1,8}$`)},
 		{RandomStringComponent{Format: "user-%7,7s", Chars: []rune("abcdef0123456789")}, regexp.MustCompile(`^user-[abcdef0123456789]{7}$`)},
 		{RandomStringComponent{Format: "num-%1,32s", Chars: []rune("0123456789")}, regexp.MustCompile(`^num-\d{1,32}$`)},
+		{RandomStringComponent{Format: "%{digits}4,4s-%{upper}2,2s"}, regexp.MustCompile(`^\d{4}-[A-Z]{2}$`)},
+		{RandomStringComponent{Format: "%sms", Chars: []rune("4567"), MinLength: 2, MaxLength: 5}, regexp.MustCompile(`^[4567]{2,5}ms$`)},
+		{RandomStringComponent{Format: "%{vowels}s%{lower}1,3s", MinLength: 2, MaxLength: 2, Classes: map[string][]rune{"vowels": []rune("aeiou")}}, regexp.MustCompile(`^[aeiou]{2}[a-z]{1,3}$`)},
+		{RandomStringComponent{Format: "100%%-%{alnum}3,3s"}, regexp.MustCompile(`^100%-[A-Za-z0-9]{3}$`)},
+		{RandomStringComponent{Chars: []rune("xy"), MinLength: 3, MaxLength: 3}, regexp.MustCompile(`^[xy]{3}$`)},
 	}
 
 	for _, test := range testTable {
@@ -34,3 +42,156 @@ func TestRandomStringComponent_String(t *testing.T) {
 
 	}
 }
+
+func TestRandomStringComponent_Lengths(t *testing.T) {
+	// Both lengths of a placeholder are inclusive, %1,3s produces strings
+	// of 1, 2 and 3 characters
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	rc := RandomStringComponent{Format: "%1,3s", Chars: []rune("x")}
+	seen := make(map[int]bool)
+	for i := 0; i < 300; i++ {
+		seen[len(rc.Random(r))] = true
+	}
+	if want := map[int]bool{1: true, 2: true, 3: true}; !reflect.DeepEqual(seen, want) {
+		t.Errorf("Generated strings of lengths %v, wanted lengths %v", seen, want)
+	}
+}
+
+func TestRandomStringComponent_Validate(t *testing.T) {
+	testTable := []RandomStringComponent{
+		{Format: "%s"},
+		{Format: "%1,4s"},
+		{Format: "%{nope}1,4s"},
+		{Format: "%{digits}5,4s"},
+		{Format: "%{digits}s"},
+		{Format: "%d", Chars: []rune("abc")},
+		{Format: "%{digits}4,4s", MinLength: 2, MaxLength: 3},
+		{Format: "%s", Chars: []rune("abc"), MinLength: -1, MaxLength: 3},
+	}
+
+	for _, rc := range testTable {
+		if err := rc.Validate(); err == nil {
+			t.Errorf("Expected an error for %+v", rc)
+		}
+	}
+
+	valid := RandomStringComponent{Format: "%{digits}4,4s-%s", Chars: []rune("abc"), MinLength: 2, MaxLength: 3}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("Unexpected error for %+v: %s", valid, err)
+	}
+}
+
+func TestChoiceComponent_String(t *testing.T) {
+	rand.Seed(time.Now().UnixNano())
+	testTable := []struct {
+		in    ChoiceComponent
+		share map[string]float64
+	}{
+		{ChoiceComponent{Values: []string{"en", "de", "fr"}}, map[string]float64{"en": 1.0 / 3, "de": 1.0 / 3, "fr": 1.0 / 3}},
+		{ChoiceComponent{Values: []string{"item", "search", "checkout"}, Weights: []float64{70, 25, 5}}, map[string]float64{"item": 0.7, "search": 0.25, "checkout": 0.05}},
+		{ChoiceComponent{Values: []string{"a", "b"}, Weights: []float64{0.9, 0.1}}, map[string]float64{"a": 0.9, "b": 0.1}},
+		{ChoiceComponent{Values: []string{"never", "always"}, Weights: []float64{0, 1}}, map[string]float64{"never": 0, "always": 1}},
+	}
+
+	const runs = 20000
+	const tolerance = 0.02
+	for _, test := range testTable {
+		counts := make(map[string]int)
+		for i := 0; i < runs; i++ {
+			actual := test.in.String()
+			if _, ok := test.share[actual]; !ok {
+				t.Fatalf("Generated value \"%s\" is not one of %v", actual, test.in.Values)
+			}
+			counts[actual]++
+		}
+
+		for v, share := range test.share {
+			actual := float64(counts[v]) / runs
+			if actual < share-tolerance || actual > share+tolerance {
+				t.Errorf("Value \"%s\" of %v was picked %.3f of the time, wanted %.3f±%.2f", v, test.in.Values, actual, share, tolerance)
+			}
+		}
+	}
+}
+
+func TestRandomIntegerComponent_String(t *testing.T) {
+	rand.Seed(time.Now().UnixNano())
+	mean200, mean0 := 200.0, 0.0
+	testTable := []struct {
+		in   RandomIntegerComponent
+		mean float64
+	}{
+		{RandomIntegerComponent{Min: 0, Max: 100}, 49.5},
+		{RandomIntegerComponent{Min: 0, Max: 100, Distribution: UniformDistribution}, 49.5},
+		{RandomIntegerComponent{Min: 1000, Max: 2000, Distribution: NormalDistribution}, 1500},
+		{RandomIntegerComponent{Min: 0, Max: 1000, Distribution: NormalDistribution, Mean: &mean200, StdDev: 20}, 199.5},
+		{RandomIntegerComponent{Min: -200, Max: 1000, Distribution: NormalDistribution, Mean: &mean0, StdDev: 20}, -0.5},
+		{RandomIntegerComponent{Min: 0, Max: 10000, Distribution: ExponentialDistribution, Rate: 0.01}, 99.5},
+	}
+
+	const runs = 20000
+	for _, test := range testTable {
+		sum := 0.0
+		for i := 0; i < runs; i++ {
+			n, err := strconv.Atoi(test.in.String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n < test.in.Min || n >= test.in.Max {
+				t.Fatalf("Generated value %d is outside of [%d, %d)", n, test.in.Min, test.in.Max)
+			}
+			sum += float64(n)
+		}
+
+		tolerance := float64(test.in.Max-test.in.Min) * 0.02
+		if mean := sum / runs; math.Abs(mean-test.mean) > tolerance {
+			t.Errorf("%+v: mean of generated values is %.1f, wanted %.1f±%.1f", test.in, mean, test.mean, tolerance)
+		}
+	}
+}
+
+func TestRandomIntegerComponent_Zipf(t *testing.T) {
+	rand.Seed(time.Now().UnixNano())
+	in := RandomIntegerComponent{Min: 100, Max: 1100, Distribution: ZipfDistribution, S: 1.5}
+
+	const runs = 20000
+	counts := make(map[int]int)
+	for i := 0; i < runs; i++ {
+		n, _ := strconv.Atoi(in.String())
+		if n < in.Min || n >= in.Max {
+			t.Fatalf("Generated value %d is outside of [%d, %d)", n, in.Min, in.Max)
+		}
+		counts[n]++
+	}
+
+	// The frequency of the k-th value is proportional to 1/k^s, so the first
+	// value should make up for 1/zeta(1.5, 1000) ≈ 0.39 of all values
+	if share := float64(counts[100]) / runs; share < 0.36 || share > 0.42 {
+		t.Errorf("Most frequent value was generated %.3f of the time, wanted about 0.39", share)
+	}
+	if counts[100] <= counts[101] || counts[101] <= counts[105] {
+		t.Errorf("Frequencies are not decreasing: %d, %d, %d", counts[100], counts[101], counts[105])
+	}
+}
+
+func TestRandomIntegerComponent_Validate(t *testing.T) {
+	testTable := []struct {
+		in    RandomIntegerComponent
+		valid bool
+	}{
+		{RandomIntegerComponent{Min: 0, Max: 10}, true},
+		{RandomIntegerComponent{Min: 10, Max: 10}, false},
+		{RandomIntegerComponent{Min: 0, Max: 10, Distribution: "pareto"}, false},
+		{RandomIntegerComponent{Min: 0, Max: 10, Distribution: ZipfDistribution, S: 2, V: 1}, true},
+		{RandomIntegerComponent{Min: 0, Max: 10, Distribution: ZipfDistribution, S: 1}, false},
+		{RandomIntegerComponent{Min: 0, Max: 10, Distribution: ZipfDistribution, V: 0.5}, false},
+		{RandomIntegerComponent{Min: 0, Max: 10, Distribution: NormalDistribution, StdDev: -1}, false},
+		{RandomIntegerComponent{Min: 0, Max: 10, Distribution: ExponentialDistribution, Rate: -1}, false},
+	}
+
+	for _, test := range testTable {
+		if err := test.in.Validate(); (err == nil) != test.valid {
+			t.Errorf("%+v: wanted valid=%t, got error %v", test.in, test.valid, err)
+		}
+	}
+}
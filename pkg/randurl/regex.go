@@ -0,0 +1,153 @@
+package randurl
+
+import (
+	"fmt"
+	"math/rand"
+	"regexp/syntax"
+	"strings"
+)
+
+// MaxUnboundedRepeat is the number of repetitions added to the minimum of
+// unbounded repetitions like *, + or {n,} when generating strings
+const MaxUnboundedRepeat = 10
+
+// unreserved are the ranges of characters that can be used in URLs
+// without escaping (RFC 3986), they are preferred when picking from
+// character classes and used for .
+var unreserved = []rune{'-', '.', '0', '9', 'A', 'Z', '_', '_', 'a', 'z', '~', '~'}
+
+// printable is the range of printable ASCII characters, which are preferred
+// when picking from character classes without unreserved characters
+var printable = []rune{0x20, 0x7e}
+
+// RegexComponent generates random strings matching a regular expression.
+// Supported are literals, character classes, repetition, alternation and
+// groups, anchors are ignored.
+type RegexComponent struct {
+	Pattern string
+	re      *syntax.Regexp
+}
+
+// NewRegexComponent parses pattern and returns an error if it contains
+// constructs that can't be used to generate strings
+func NewRegexComponent(pattern string) (RegexComponent, error) {
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return RegexComponent{}, err
+	}
+	if err := checkRegex(re); err != nil {
+		return RegexComponent{}, err
+	}
+	return RegexComponent{Pattern: pattern, re: re}, nil
+}
+
+func checkRegex(re *syntax.Regexp) error {
+	switch re.Op {
+	case syntax.OpNoMatch, syntax.OpWordBoundary, syntax.OpNoWordBoundary:
+		return fmt.Errorf("unsupported expression %s", re)
+	case syntax.OpCharClass:
+		if len(re.Rune) == 0 {
+			return fmt.Errorf("empty character class %s", re)
+		}
+	}
+	for _, sub := range re.Sub {
+		if err := checkRegex(sub); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r RegexComponent) String() string {
+	return r.Random(globalRand)
+}
+
+func (r RegexComponent) Random(rnd *rand.Rand) string {
+	b := new(strings.Builder)
+	generateRegex(b, r.re, rnd)
+	return b.String()
+}
+
+func generateRegex(b *strings.Builder, re *syntax.Regexp, r *rand.Rand) {
+	switch re.Op {
+	case syntax.OpLiteral:
+		b.WriteString(string(re.Rune))
+	case syntax.OpCharClass:
+		b.WriteRune(pickRune(r, re.Rune))
+	case syntax.OpAnyCharNotNL, syntax.OpAnyChar:
+		b.WriteRune(pickRune(r, unreserved))
+	case syntax.OpCapture:
+		generateRegex(b, re.Sub[0], r)
+	case syntax.OpConcat:
+		for _, sub := range re.Sub {
+			generateRegex(b, sub, r)
+		}
+	case syntax.OpAlternate:
+		generateRegex(b, re.Sub[r.Intn(len(re.Sub))], r)
+	case syntax.OpStar, syntax.OpPlus, syntax.OpQuest, syntax.OpRepeat:
+		min, max := re.Min, re.Max
+		switch re.Op {
+		case syntax.OpStar:
+			min, max = 0, -1
+		case syntax.OpPlus:
+			min, max = 1, -1
+		case syntax.OpQuest:
+			min, max = 0, 1
+		}
+		if max < 0 {
+			max = min + MaxUnboundedRepeat
+		}
+		n := min + r.Intn(max-min+1)
+		for i := 0; i < n; i++ {
+			generateRegex(b, re.Sub[0], r)
+		}
+	}
+	// OpEmptyMatch and anchors don't produce any output
+}
+
+// pickRune returns a random rune of ranges, which contains pairs of the
+// lowest and highest rune of a range. Unreserved characters are preferred
+// if the ranges contain any, followed by printable ASCII characters.
+func pickRune(rnd *rand.Rand, ranges []rune) rune {
+	r := ranges
+	if u := intersectRanges(r, unreserved); len(u) > 0 {
+		r = u
+	} else if p := intersectRanges(r, printable); len(p) > 0 {
+		r = p
+	}
+
+	total := 0
+	for i := 0; i < len(r); i += 2 {
+		total += int(r[i+1]-r[i]) + 1
+	}
+	n := rnd.Intn(total)
+	for i := 0; i < len(r); i += 2 {
+		size := int(r[i+1]-r[i]) + 1
+		if n < size {
+			return r[i] + rune(n)
+		}
+		n -= size
+	}
+	return r[0]
+}
+
+// intersectRanges returns the parts of the ranges in r that are within the
+// ranges in limit
+func intersectRanges(r []rune, limit []rune) []rune {
+	var out []rune
+	for i := 0; i < len(r); i += 2 {
+		for j := 0; j < len(limit); j += 2 {
+			lo, hi := r[i], r[i+1]
+			if lo < limit[j] {
+				lo = limit[j]
+			}
+			if hi > limit[j+1] {
+				hi = limit[j+1]
+			}
+			if lo <= hi {
+				out = append(out, lo, hi)
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,66 @@
+package randurl
+
+import (
+	"net/url"
+	"regexp"
+	"testing"
+)
+
+func TestRegexComponent_String(t *testing.T) {
+	testTable := []string{
+		`[A-Z]{2}-\d{6}`,
+		`user-[0-9a-f]{4}(-[0-9a-f]{4}){3}`,
+		`(books|music|films)/\w+`,
+		`^v[12]\.\d?$`,
+		`[^/?#]{1,8}`,
+		`a*b+c?`,
+		`(?i)sku`,
+		`\pL{3}`,
+		`x{3,}.`,
+	}
+
+	for _, pattern := range testTable {
+		rc, err := NewRegexComponent(pattern)
+		if err != nil {
+			t.Errorf("Unexpected error for %s: %s", pattern, err)
+			continue
+		}
+		re := regexp.MustCompile(`^(?:` + pattern + `)$`)
+		for i := 0; i < 100; i++ {
+			if s := rc.String(); !re.MatchString(s) {
+				t.Errorf("%q does not match %s", s, pattern)
+			}
+		}
+	}
+}
+
+func TestRegexComponent_PathSafe(t *testing.T) {
+	// . and negated classes only produce characters that don't need to be
+	// escaped in URLs
+	for _, pattern := range []string{`.{5}`, `[^a-z]{5}`, `(?s).{5}`} {
+		rc, err := NewRegexComponent(pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 1000; i++ {
+			if s := rc.String(); url.PathEscape(s) != s {
+				t.Fatalf("%q generated by %s is not path-safe", s, pattern)
+			}
+		}
+	}
+}
+
+func TestNewRegexComponent_Invalid(t *testing.T) {
+	testTable := []string{
+		`[a-`,
+		`(abc`,
+		`\bword`,
+		`[^\x00-\x{10FFFF}]`,
+	}
+
+	for _, pattern := range testTable {
+		if _, err := NewRegexComponent(pattern); err == nil {
+			t.Errorf("Expected an error for %s", pattern)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package randurl
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+)
+
+// Variables hold values that are only known at runtime, e.g. extracted
+// from responses. Values not found are looked up in the parent Variables.
+// It is safe for concurrent use.
+type Variables struct {
+	parent *Variables
+
+	mu     sync.RWMutex
+	values map[string][]string
+}
+
+// NewVariables returns empty Variables falling back to parent, which can
+// be nil
+func NewVariables(parent *Variables) *Variables {
+	return &Variables{parent: parent, values: make(map[string][]string)}
+}
+
+// Add adds value to the values of the variable name
+func (v *Variables) Add(name, value string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.values[name] = append(v.values[name], value)
+}
+
+// Get returns the values of the variable name
+func (v *Variables) Get(name string) []string {
+	v.mu.RLock()
+	values, ok := v.values[name]
+	v.mu.RUnlock()
+	if !ok && v.parent != nil {
+		return v.parent.Get(name)
+	}
+	return values
+}
+
+// VariableComponent is a value of a variable, a random one if the variable
+// has several values. Without values it is the name of the variable in
+// braces, e.g. {userID}.
+type VariableComponent struct {
+	Name      string
+	Variables *Variables
+}
+
+func (c VariableComponent) String() string {
+	return c.Random(globalRand)
+}
+
+// Random returns a value of the variable chosen using r
+func (c VariableComponent) Random(r *rand.Rand) string {
+	values := c.Variables.Get(c.Name)
+	if len(values) == 0 {
+		return fmt.Sprintf("{%s}", c.Name)
+	}
+	return values[r.Intn(len(values))]
+}
@@ -0,0 +1,35 @@
+package randurl
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestVariables(t *testing.T) {
+	file := NewVariables(nil)
+	file.Add("token", "abc")
+	test := NewVariables(file)
+	test.Add("userID", "1")
+	test.Add("userID", "2")
+
+	if v := test.Get("token"); len(v) != 1 || v[0] != "abc" {
+		t.Errorf("Expected token from the parent, got %v", v)
+	}
+	if v := file.Get("userID"); v != nil {
+		t.Errorf("Values should not be visible in the parent, got %v", v)
+	}
+
+	c := VariableComponent{Name: "userID", Variables: test}
+	r := rand.New(rand.NewSource(1))
+	seen := make(map[string]bool)
+	for i := 0; i < 50; i++ {
+		seen[c.Random(r)] = true
+	}
+	if len(seen) != 2 || !seen["1"] || !seen["2"] {
+		t.Errorf("Expected both values to be used, got %v", seen)
+	}
+
+	if v := (VariableComponent{Name: "missing", Variables: test}).String(); v != "{missing}" {
+		t.Errorf("Expected {missing} for a variable without values, got %s", v)
+	}
+}